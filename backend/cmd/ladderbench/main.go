@@ -0,0 +1,60 @@
+// ladderbench compara o custo dos pipelines de transcodificação (um FFmpeg por
+// qualidade x um FFmpeg para a escada inteira) em um arquivo de vídeo local.
+//
+//	go run ./cmd/ladderbench -input filme.mkv -seconds 60
+//
+// Também confere se todas as qualidades cortam os segmentos nos mesmos instantes
+// (requisito para a troca de qualidade sem emendas); sai com status 1 se não cortarem.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"webtorrent-player/torrent"
+)
+
+func main() {
+	input := flag.String("input", "", "arquivo de vídeo local")
+	seconds := flag.Float64("seconds", 60, "segundos da fonte a transcodificar")
+	flag.Parse()
+
+	if *input == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	outDir, err := os.MkdirTemp("", "ladderbench-")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(outDir)
+
+	misaligned := false
+	fmt.Printf("%-12s %9s %9s %10s %10s %9s %8s %9s\n", "pipeline", "qualid.", "processos", "tempo", "cpu", "segmentos", "x real", "alinhado")
+	for _, pipeline := range []string{torrent.PipelinePerQuality, torrent.PipelineSingle} {
+		result, err := torrent.BenchmarkPipeline(pipeline, *input, *seconds, filepath.Join(outDir, pipeline))
+		if err != nil {
+			log.Fatalf("%s: %v", pipeline, err)
+		}
+		aligned := "sim"
+		if result.Misaligned != "" {
+			aligned = "não"
+			misaligned = true
+		}
+		fmt.Printf("%-12s %9d %9d %10s %10s %9d %7.2fx %9s\n",
+			result.Pipeline, result.Qualities, result.Processes,
+			result.Wall.Round(1e7), result.CPU.Round(1e7), result.Segments,
+			*seconds/result.Wall.Seconds(), aligned)
+		if result.Misaligned != "" {
+			fmt.Printf("  %s\n", result.Misaligned)
+		}
+	}
+
+	if misaligned {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+
+	"webtorrent-player/torrent"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireAdmin protege as rotas de administração. Com token, só aceita
+// "Authorization: Bearer <token>"; sem token, só aceita conexões de loopback
+// (o IP da conexão, não o X-Forwarded-For, que o cliente controla).
+func RequireAdmin(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			ip := net.ParseIP(c.RemoteIP())
+			if ip == nil || !ip.IsLoopback() {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Acesso permitido apenas localmente (defina ADMIN_TOKEN)"})
+				return
+			}
+			c.Next()
+			return
+		}
+
+		given, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token de administração inválido"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetFFmpegQueue retorna o estado do scheduler de FFmpeg: orçamento, processos rodando,
+// pausados e na fila, com a prioridade de cada um
+func GetFFmpegQueue(c *gin.Context) {
+	c.JSON(http.StatusOK, torrent.FFmpegQueue())
+}
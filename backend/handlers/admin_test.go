@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		token      string
+		remoteAddr string
+		header     string
+		want       int
+	}{
+		{"loopback sem token", "", "127.0.0.1:5000", "", http.StatusOK},
+		{"loopback IPv6 sem token", "", "[::1]:5000", "", http.StatusOK},
+		{"remoto sem token", "", "203.0.113.7:5000", "", http.StatusForbidden},
+		{"token correto", "segredo", "203.0.113.7:5000", "Bearer segredo", http.StatusOK},
+		{"token errado", "segredo", "203.0.113.7:5000", "Bearer outro", http.StatusUnauthorized},
+		{"token sem Bearer", "segredo", "203.0.113.7:5000", "segredo", http.StatusUnauthorized},
+		{"loopback com token exige token", "segredo", "127.0.0.1:5000", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/api/admin/ffmpeg", RequireAdmin(tt.token), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/ffmpeg", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", "127.0.0.1") // Forjado: não pode liberar o acesso remoto
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, esperado %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"webtorrent-player/torrent"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDASHManifest retorna o manifesto MPEG-DASH da mesma escada de qualidades do HLS
+func GetDASHManifest(c *gin.Context) {
+	id := c.Param("id")
+
+	stream, ok := torrent.GetStream(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stream não encontrado"})
+		return
+	}
+
+	state := stream.State()
+	if state != torrent.StateReady && state != torrent.StateTranscoding {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Stream ainda não está pronto"})
+		return
+	}
+
+	manifest, err := torrent.BuildDASHManifest(stream, stream.ViewerLadder(id))
+	if errors.Is(err, torrent.ErrDASHRequiresFMP4) {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Data(http.StatusOK, "application/dash+xml", manifest)
+}
@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"webtorrent-player/torrent"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetStreamEvents envia o status do stream em tempo real via Server-Sent Events.
+// Eventos: snapshot (status completo ao conectar), status (transições),
+// stats (progresso/peers/velocidade a cada segundo) e quality (qualidade pronta).
+func GetStreamEvents(c *gin.Context) {
+	id := c.Param("id")
+
+	stream, ok := torrent.GetStream(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stream não encontrado"})
+		return
+	}
+
+	events, unsubscribe := stream.Subscribe()
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // Nginx não deve bufferizar o SSE
+
+	c.SSEvent("snapshot", statusPayload(stream, id))
+	c.Writer.Flush()
+
+	// Comentário periódico mantém a conexão viva em proxies
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-stream.Done():
+			// Stream removido: encerrar o SSE
+			return false
+		case event := <-events:
+			c.SSEvent(event.Type, event.Data)
+			return true
+		case <-keepAlive.C:
+			torrent.GetStream(id) // Conexão aberta mantém a sessão do espectador ativa
+			io.WriteString(w, ": keep-alive\n\n")
+			return true
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"webtorrent-player/torrent"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestGetStreamEventsSnapshot(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	sessionID, stream := torrent.RegisterTestStream(strings.Repeat("cd", 20), t.TempDir(), nil)
+	defer torrent.RemoveTestStream(stream)
+
+	r := gin.New()
+	r.GET("/api/stream/:id/events", GetStreamEvents)
+	server := httptest.NewServer(r)
+	defer server.Close()
+
+	// Stream inexistente: 404 em vez de um SSE vazio
+	resp, err := http.Get(server.URL + "/api/stream/inexistente/events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("stream inexistente: status %d, esperado 404", resp.StatusCode)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/api/stream/"+sessionID+"/events", nil)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/event-stream") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	// O primeiro evento é o snapshot completo, com as URLs da sessão
+	scanner := bufio.NewScanner(resp.Body)
+	var event, data string
+	for scanner.Scan() && data == "" {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event:"); ok {
+			event = name
+		}
+		if payload, ok := strings.CutPrefix(line, "data:"); ok {
+			data = payload
+		}
+	}
+	if event != "snapshot" {
+		t.Fatalf("primeiro evento %q, esperado snapshot", event)
+	}
+	var snapshot struct {
+		Status string `json:"status"`
+		HLSURL string `json:"hlsUrl"`
+	}
+	if err := json.Unmarshal([]byte(data), &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Status != string(torrent.StateTranscoding) || !strings.Contains(snapshot.HLSURL, sessionID) {
+		t.Errorf("snapshot = %+v", snapshot)
+	}
+}
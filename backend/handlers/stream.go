@@ -1,48 +1,197 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"webtorrent-player/torrent"
 
+	"github.com/anacrolix/torrent/metainfo"
 	"github.com/gin-gonic/gin"
 )
 
 type StreamRequest struct {
-	Input string `json:"input" binding:"required"` // Magnet link ou hash
+	Input      string `json:"input" binding:"required"` // Magnet link ou hash
+	FileIndex  *int   `json:"fileIndex"`                // Arquivo do torrent a reproduzir (opcional)
+	MinQuality string `json:"minQuality"`               // Menor qualidade a gerar, ex: "480p" (opcional)
+	MaxQuality string `json:"maxQuality"`               // Maior qualidade a gerar, ex: "1080p" (opcional)
+}
+
+type SelectFileRequest struct {
+	FileIndex *int `json:"fileIndex" binding:"required"`
 }
 
 type StreamResponse struct {
-	ID      string `json:"id"`
-	Message string `json:"message"`
+	ID       string `json:"id"`       // ID da sessão do espectador (usado nas demais rotas)
+	StreamID string `json:"streamId"` // ID do stream compartilhado entre espectadores
+	Viewers  int    `json:"viewers"`
+	Message  string `json:"message"`
 }
 
-// StartStream inicia um novo stream de torrent
+// Tamanho máximo aceito para arquivos .torrent enviados
+const maxTorrentFileSize = 10 * 1024 * 1024
+
+// StartStream inicia um novo stream de torrent.
+// Aceita JSON ({"input": "magnet ou hash"}), upload multipart com o campo "torrent"
+// ou o conteúdo bruto do .torrent com Content-Type application/x-bittorrent.
 func StartStream(c *gin.Context) {
+	switch c.ContentType() {
+	case "multipart/form-data":
+		startStreamFromUpload(c)
+		return
+	case "application/x-bittorrent":
+		startStreamFromBody(c)
+		return
+	}
+
 	var req StreamRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Input é obrigatório (magnet link ou hash)"})
 		return
 	}
 
+	if err := torrent.ValidateQualityRange(req.MinQuality, req.MaxQuality); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Converter hash para magnet link se necessário
 	magnetLink := torrent.ParseInput(req.Input)
 
-	stream, err := torrent.StartStream(magnetLink)
+	viewer, err := torrent.StartStream(magnetLink, torrent.StreamOptions{
+		FileIndex:  req.FileIndex,
+		MinQuality: req.MinQuality,
+		MaxQuality: req.MaxQuality,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(startErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
+	respondViewer(c, viewer)
+}
+
+// startErrorStatus escolhe o status HTTP de um erro ao iniciar o stream
+func startErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, torrent.ErrInvalidMagnet):
+		return http.StatusBadRequest
+	case errors.Is(err, torrent.ErrViewerConflict):
+		return http.StatusConflict
+	case errors.Is(err, torrent.ErrStreamLimit):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// respondViewer responde com a sessão criada para o espectador
+func respondViewer(c *gin.Context, viewer *torrent.Viewer) {
+	message := "Stream iniciado com sucesso"
+	if viewer.Joined {
+		message = "Conectado a stream já em andamento"
+	}
+
 	c.JSON(http.StatusOK, StreamResponse{
-		ID:      stream.ID,
-		Message: "Stream iniciado com sucesso",
+		ID:       viewer.ID,
+		StreamID: viewer.Stream.ID,
+		Viewers:  viewer.Stream.Viewers(),
+		Message:  message,
 	})
 }
 
+// startStreamFromUpload inicia um stream a partir de um .torrent enviado via multipart
+func startStreamFromUpload(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxTorrentFileSize)
+
+	fileHeader, err := c.FormFile("torrent")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Arquivo .torrent é obrigatório (campo \"torrent\")"})
+		return
+	}
+
+	f, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Erro ao ler arquivo .torrent"})
+		return
+	}
+	defer f.Close()
+
+	mi, err := torrent.LoadTorrentFile(f)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fileIndex, ok := parseFileIndex(c, c.PostForm("fileIndex"))
+	if !ok {
+		return
+	}
+
+	respondTorrentStream(c, mi, torrent.StreamOptions{
+		FileIndex:  fileIndex,
+		MinQuality: c.PostForm("minQuality"),
+		MaxQuality: c.PostForm("maxQuality"),
+	})
+}
+
+// startStreamFromBody inicia um stream a partir do .torrent enviado como corpo bruto
+func startStreamFromBody(c *gin.Context) {
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxTorrentFileSize)
+
+	mi, err := torrent.LoadTorrentFile(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	fileIndex, ok := parseFileIndex(c, c.Query("fileIndex"))
+	if !ok {
+		return
+	}
+
+	respondTorrentStream(c, mi, torrent.StreamOptions{
+		FileIndex:  fileIndex,
+		MinQuality: c.Query("minQuality"),
+		MaxQuality: c.Query("maxQuality"),
+	})
+}
+
+// parseFileIndex converte o índice de arquivo opcional vindo de formulário/query.
+// Retorna false se já respondeu ao cliente com erro.
+func parseFileIndex(c *gin.Context, value string) (*int, bool) {
+	if value == "" {
+		return nil, true
+	}
+
+	index, err := strconv.Atoi(value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fileIndex inválido"})
+		return nil, false
+	}
+	return &index, true
+}
+
+func respondTorrentStream(c *gin.Context, mi *metainfo.MetaInfo, opts torrent.StreamOptions) {
+	if err := torrent.ValidateQualityRange(opts.MinQuality, opts.MaxQuality); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	viewer, err := torrent.StartStreamFromTorrent(mi, opts)
+	if err != nil {
+		c.JSON(startErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	respondViewer(c, viewer)
+}
+
 // GetStreamStatus retorna o status de um stream
 func GetStreamStatus(c *gin.Context) {
 	id := c.Param("id")
@@ -53,25 +202,93 @@ func GetStreamStatus(c *gin.Context) {
 		return
 	}
 
+	c.JSON(http.StatusOK, statusPayload(stream, id))
+}
+
+// statusPayload monta a resposta de status (usada também como snapshot inicial do SSE).
+// id é o da rota: com o ID da sessão, as URLs de playlist/manifesto aplicam os limites
+// de qualidade do espectador (ver ViewerLadder).
+func statusPayload(stream *torrent.StreamInfo, id string) gin.H {
+	snap := stream.Snapshot()
 	peers, downloaded, speed := stream.GetPeerStats()
 	
-	c.JSON(http.StatusOK, gin.H{
-		"id":           stream.ID,
-		"status":       stream.Status,
-		"progress":     stream.Progress,
-		"fileName":     stream.FileName,
-		"error":        stream.Error,
+	return gin.H{
+		"id":           snap.ID,
+		"status":       snap.State,
+		"progress":     snap.Progress,
+		"fileName":     snap.FileName,
+		"fileIndex":    snap.FileIndex,
+		"infoHash":     snap.InfoHash,
+		"viewers":      stream.Viewers(),
+		"error":        snap.Error,
 		"peers":        peers,
 		"downloaded":   downloaded,   // Total baixado em MB
 		"speed":        speed,        // Velocidade instantânea em MB/s
-		"qualities":    stream.Qualities,
-		"sourceWidth":  stream.SourceWidth,
-		"sourceHeight": stream.SourceHeight,
-		"audioTracks":  stream.AudioTracks, // Faixas de áudio disponíveis
-		"hlsUrl":       "/api/stream/" + stream.ID + "/master.m3u8",
+		"qualities":    snap.Qualities,
+		"transcodes":   snap.Transcodes, // Progresso real do FFmpeg por qualidade
+		"sourceWidth":  snap.SourceWidth,
+		"sourceHeight": snap.SourceHeight,
+		"hdrFormat":    snap.HDRFormat, // HDR10, HLG, DolbyVision ou "" (SDR)
+		"audioTracks":  snap.AudioTracks, // Faixas de áudio disponíveis
+		"subtitleTracks": snap.SubtitleTracks, // Legendas WebVTT disponíveis
+		"thumbnailsUrl": stream.ThumbnailsURL(), // Trilha WebVTT de miniaturas ("" = sem)
+		"hlsUrl":       "/api/stream/" + id + "/master.m3u8",
+		"dashUrl":      "/api/stream/" + id + "/manifest.mpd",
+	}
+}
+
+// GetStreamFiles retorna a árvore de arquivos do torrent (aguarda os metadados)
+func GetStreamFiles(c *gin.Context) {
+	id := c.Param("id")
+
+	stream, ok := torrent.GetStream(id)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stream não encontrado"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 60*time.Second)
+	defer cancel()
+
+	files, err := stream.WaitFiles(ctx)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"id":    stream.ID,
+		"files": files,
 	})
 }
 
+// SelectStreamFile troca o arquivo do torrent que está sendo reproduzido
+func SelectStreamFile(c *gin.Context) {
+	id := c.Param("id")
+
+	var req SelectFileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fileIndex é obrigatório"})
+		return
+	}
+
+	if _, ok := torrent.GetStream(id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stream não encontrado"})
+		return
+	}
+
+	if err := torrent.SelectFile(id, *req.FileIndex); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, torrent.ErrViewerConflict) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Arquivo selecionado com sucesso"})
+}
+
 // GetPlaylist retorna a playlist HLS (master ou de qualidade específica)
 func GetPlaylist(c *gin.Context) {
 	id := c.Param("id")
@@ -82,22 +299,24 @@ func GetPlaylist(c *gin.Context) {
 		return
 	}
 
-	if stream.Status != "ready" && stream.Status != "transcoding" {
+	snap := stream.Snapshot()
+	if snap.State != torrent.StateReady && snap.State != torrent.StateTranscoding {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Stream ainda não está pronto"})
 		return
 	}
 
 	// Tentar master playlist primeiro
-	playlistPath := filepath.Join(stream.HLSPath, "master.m3u8")
+	playlistPath := filepath.Join(snap.HLSPath, "master.m3u8")
 	
-	if _, err := os.Stat(playlistPath); os.IsNotExist(err) {
+	data, err := os.ReadFile(playlistPath)
+	if err != nil {
 		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Playlist ainda não gerada"})
 		return
 	}
 
-	c.Header("Content-Type", "application/vnd.apple.mpegurl")
+	// Quem entrou com limites de qualidade próprios só recebe as variantes dentro deles
 	c.Header("Cache-Control", "no-cache")
-	c.File(playlistPath)
+	c.Data(http.StatusOK, "application/vnd.apple.mpegurl", torrent.FilterMasterPlaylist(data, stream.ViewerLadder(id)))
 }
 
 // GetQualityPlaylist retorna a playlist de uma qualidade específica
@@ -111,7 +330,11 @@ func GetQualityPlaylist(c *gin.Context) {
 		return
 	}
 
-	playlistPath := filepath.Join(stream.HLSPath, quality, "playlist.m3u8")
+	playlistPath, ok := safeJoin(stream.Snapshot().HLSPath, quality, stream.PlaylistName(quality))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Playlist não encontrada"})
+		return
+	}
 
 	// IMPORTANTE: o master.m3u8 é gerado antes das playlists de cada qualidade.
 	// O Shaka tende a solicitar TODAS as playlists listadas no master durante o load.
@@ -123,7 +346,7 @@ func GetQualityPlaylist(c *gin.Context) {
 			break
 		}
 
-		if stream.Status == "error" {
+		if stream.State() == torrent.StateError {
 			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Stream em erro"})
 			return
 		}
@@ -145,9 +368,10 @@ func GetQualityPlaylist(c *gin.Context) {
 	c.File(playlistPath)
 }
 
-// GetSegment retorna um segmento HLS
-func GetSegment(c *gin.Context) {
+// GetQualitySegment retorna um segmento de qualidade específica
+func GetQualitySegment(c *gin.Context) {
 	id := c.Param("id")
+	quality := c.Param("quality")
 	segment := c.Param("segment")
 
 	stream, ok := torrent.GetStream(id)
@@ -156,43 +380,51 @@ func GetSegment(c *gin.Context) {
 		return
 	}
 
-	// Verificar se é um segmento de qualidade específica (ex: 720p/segment001.ts)
-	segmentPath := filepath.Join(stream.HLSPath, segment)
-
-	// Evitar servir segmento enquanto ainda está sendo escrito (arquivo parcial)
-	if !waitForStableFile(c, segmentPath, 30*time.Second, 200*time.Millisecond) {
-		return
-	}
-
-	c.Header("Content-Type", "video/mp2t")
-	c.Header("Cache-Control", "max-age=3600")
-	c.File(segmentPath)
-}
-
-// GetQualitySegment retorna um segmento de qualidade específica
-func GetQualitySegment(c *gin.Context) {
-	id := c.Param("id")
-	quality := c.Param("quality")
-	segment := c.Param("segment")
-
-	stream, ok := torrent.GetStream(id)
+	segmentPath, ok := safeJoin(stream.Snapshot().HLSPath, quality, segment)
 	if !ok {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Stream não encontrado"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Segmento não encontrado"})
 		return
 	}
 
-	segmentPath := filepath.Join(stream.HLSPath, quality, segment)
+	// Segmento muito à frente do que já foi gerado: reposicionar download e FFmpeg.
+	// Nesse caso o segmento demora mais (peças + reinício do FFmpeg), então esperamos mais.
+	timeout := 30 * time.Second
+	if torrent.RequestSegment(stream, quality, segment) {
+		timeout = 120 * time.Second
+	}
 
 	// Evitar servir segmento enquanto ainda está sendo escrito (arquivo parcial)
-	if !waitForStableFile(c, segmentPath, 30*time.Second, 200*time.Millisecond) {
+	if !waitForStableFile(c, segmentPath, timeout, 200*time.Millisecond) {
 		return
 	}
 
-	c.Header("Content-Type", "video/mp2t")
-	c.Header("Cache-Control", "max-age=3600")
+	c.Header("Content-Type", segmentContentType(segment))
+	if ext := filepath.Ext(segment); ext == ".mp4" || ext == ".vtt" {
+		// O init é regravado quando o FFmpeg reinicia (seek/troca de arquivo)
+		// e as legendas embutidas, a cada nova extração durante o download
+		c.Header("Cache-Control", "no-cache")
+	} else {
+		c.Header("Cache-Control", "max-age=3600")
+	}
 	c.File(segmentPath)
 }
 
+// segmentContentType retorna o Content-Type de um segmento pela extensão
+func segmentContentType(name string) string {
+	switch filepath.Ext(name) {
+	case ".vtt":
+		return "text/vtt"
+	case ".m4s":
+		return "video/iso.segment"
+	case ".mp4":
+		return "video/mp4" // Segmento de inicialização fMP4
+	case ".jpg":
+		return "image/jpeg" // Folha de miniaturas
+	default:
+		return "video/mp2t"
+	}
+}
+
 // waitForStableFile aguarda um arquivo existir e ficar com tamanho estável por um curto período.
 // Retorna false se já respondeu ao cliente (404/timeout/cancel).
 func waitForStableFile(c *gin.Context, path string, timeout time.Duration, stableWindow time.Duration) bool {
@@ -252,11 +484,15 @@ func waitForStableFile(c *gin.Context, path string, timeout time.Duration, stabl
 	}
 }
 
-// StopStream para e limpa um stream
+// StopStream encerra a sessão de um espectador (o stream é limpo quando o último sai)
 func StopStream(c *gin.Context) {
 	id := c.Param("id")
 
 	err := torrent.StopStream(id)
+	if errors.Is(err, torrent.ErrStopBySession) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		// Retornar sucesso mesmo se não encontrado (idempotente)
 		// Isso evita erros quando o stream já foi removido
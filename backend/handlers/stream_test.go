@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"webtorrent-player/torrent"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testMasterPlaylist = `#EXTM3U
+#EXT-X-VERSION:3
+
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.4d4028",NAME="360p"
+360p/playlist.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=1400000,RESOLUTION=854x480,CODECS="avc1.4d4028",NAME="480p"
+480p/playlist.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2800000,RESOLUTION=1280x720,CODECS="avc1.4d4028",NAME="720p"
+720p/playlist.m3u8
+`
+
+// getJSON faz um GET no router e decodifica a resposta
+func getJSON(t *testing.T, r *gin.Engine, url string, out any) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d: %s", url, w.Code, w.Body.String())
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJoinerMasterPlaylistHonorsQualityLimits(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	hlsDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(hlsDir, "master.m3u8"), []byte(testMasterPlaylist), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	infoHash := strings.Repeat("ab", 20)
+	ladder := []torrent.QualityLevel{
+		{Name: "360p", Width: 640, Height: 360},
+		{Name: "480p", Width: 854, Height: 480},
+		{Name: "720p", Width: 1280, Height: 720},
+	}
+	first, stream := torrent.RegisterTestStream(infoHash, hlsDir, ladder)
+	defer torrent.RemoveTestStream(stream)
+
+	joiner, err := torrent.StartStream("magnet:?xt=urn:btih:"+infoHash, torrent.StreamOptions{MaxQuality: "480p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !joiner.Joined || joiner.Stream != stream {
+		t.Fatal("o segundo espectador não entrou no stream existente")
+	}
+
+	r := gin.New()
+	r.GET("/api/stream/:id/status", GetStreamStatus)
+	r.GET("/api/stream/:id/master.m3u8", GetPlaylist)
+
+	tests := []struct {
+		session string
+		want    []string
+		absent  []string
+	}{
+		{first, []string{"360p/", "480p/", "720p/"}, nil},
+		{joiner.ID, []string{"360p/", "480p/"}, []string{"720p/"}},
+	}
+	for _, tt := range tests {
+		var status struct {
+			HLSURL  string `json:"hlsUrl"`
+			DASHURL string `json:"dashUrl"`
+		}
+		getJSON(t, r, "/api/stream/"+tt.session+"/status", &status)
+
+		// As URLs são da sessão, não do stream compartilhado
+		if !strings.Contains(status.HLSURL, tt.session) || !strings.Contains(status.DASHURL, tt.session) {
+			t.Fatalf("URLs sem a sessão %s: %s, %s", tt.session, status.HLSURL, status.DASHURL)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, status.HLSURL, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d", status.HLSURL, w.Code)
+		}
+		body := w.Body.String()
+		for _, variant := range tt.want {
+			if !strings.Contains(body, variant+"playlist.m3u8") {
+				t.Errorf("sessão %s: master sem %s", tt.session, variant)
+			}
+		}
+		for _, variant := range tt.absent {
+			if strings.Contains(body, variant+"playlist.m3u8") {
+				t.Errorf("sessão %s: master com %s, fora do limite do espectador", tt.session, variant)
+			}
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"webtorrent-player/torrent"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Nomes de segmento gerados pelo muxer HLS (vídeo MPEG-TS ou fMP4 com seu init)
+// e pelo segmentador WebVTT (legendas)
+var segmentNamePattern = regexp.MustCompile(`^(segment[0-9]{3,}\.(ts|m4s|vtt)|init(_[0-9A-Za-z]+)?\.mp4|sprite[0-9]{3,}\.jpg|thumbnails\.vtt)$`)
+
+// renditionSet é o que ValidateRendition precisa saber do stream
+type renditionSet interface {
+	HasRendition(name string) bool
+}
+
+// lookupRenditions busca o stream da rota (substituída nos testes por um stream em memória)
+var lookupRenditions = func(id string) (renditionSet, bool) {
+	stream, ok := torrent.GetStream(id)
+	if !ok {
+		return nil, false
+	}
+	return stream, true
+}
+
+// ValidateRendition protege as rotas de qualidade/segmento: só aceita qualidades que
+// existem na escada do stream (ou renditions de legenda) e nomes de segmento no padrão
+// do muxer. Qualquer outra coisa (.., caminhos absolutos, %2e%2e decodificado) é 404.
+func ValidateRendition(c *gin.Context) {
+	stream, ok := lookupRenditions(c.Param("id"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Stream não encontrado"})
+		return
+	}
+
+	if !stream.HasRendition(c.Param("quality")) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Qualidade não encontrada"})
+		return
+	}
+
+	if segment := c.Param("segment"); segment != "" && !segmentNamePattern.MatchString(segment) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Segmento não encontrado"})
+		return
+	}
+
+	c.Next()
+}
+
+// safeJoin junta elementos a base garantindo que o resultado continua dentro dela.
+// Base vazia (HLS ainda não criado) é recusada: seria relativa ao diretório do processo.
+func safeJoin(base string, elem ...string) (string, bool) {
+	if base == "" {
+		return "", false
+	}
+	joined := filepath.Join(append([]string{base}, elem...)...)
+
+	rel, err := filepath.Rel(base, joined)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) || filepath.IsAbs(rel) {
+		return "", false
+	}
+	return joined, true
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeRenditions é um stream em memória com as renditions dadas
+type fakeRenditions map[string]bool
+
+func (f fakeRenditions) HasRendition(name string) bool {
+	return f[name]
+}
+
+// newValidateRouter monta as rotas de qualidade/segmento como em main.go, com um handler
+// final que só registra se foi alcançado
+func newValidateRouter(t *testing.T, reached *bool) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	previous := lookupRenditions
+	lookupRenditions = func(id string) (renditionSet, bool) {
+		if id != "abc" {
+			return nil, false
+		}
+		return fakeRenditions{"720p": true, "sub0": true, "thumbs": true}, true
+	}
+	t.Cleanup(func() { lookupRenditions = previous })
+
+	handler := func(c *gin.Context) {
+		*reached = true
+		c.Status(http.StatusOK)
+	}
+	r := gin.New()
+	r.GET("/api/stream/:id/:quality/playlist.m3u8", ValidateRendition, handler)
+	r.GET("/api/stream/:id/:quality/:segment", ValidateRendition, handler)
+	return r
+}
+
+func TestValidateRenditionRejectsTraversal(t *testing.T) {
+	paths := []string{
+		"/api/stream/abc/%2e%2e/segment003.m4s",
+		"/api/stream/abc/%2E%2E/playlist.m3u8",
+		"/api/stream/abc/720p/%2e%2e",
+		"/api/stream/abc/720p/..%2fmaster.m3u8",
+		"/api/stream/abc/..%2f..%2f/segment003.m4s",
+		"/api/stream/abc/720p/..%2f..%2fetc%2fpasswd",
+		"/api/stream/abc/720p//etc/passwd",
+		"/api/stream/abc/720p/%2Fetc%2Fpasswd",
+		"/api/stream/abc/%2Fetc%2Fpasswd/segment003.m4s",
+		"/api/stream/abc/720p/segment003.m4s%00.txt",
+		"/api/stream/abc/720p/playlist.m3u8.bak",
+	}
+
+	for _, path := range paths {
+		reached := false
+		r := newValidateRouter(t, &reached)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if w.Code != http.StatusBadRequest && w.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, esperado 400 ou 404", path, w.Code)
+		}
+		if reached {
+			t.Errorf("%s: chegou ao handler", path)
+		}
+	}
+}
+
+func TestValidateRenditionUnknown(t *testing.T) {
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"/api/stream/abc/1080p/segment003.m4s", http.StatusNotFound}, // Qualidade fora da escada
+		{"/api/stream/abc/1080p/playlist.m3u8", http.StatusNotFound},
+		{"/api/stream/abc/sub9/segment000.vtt", http.StatusNotFound}, // Legenda inexistente
+		{"/api/stream/xyz/720p/segment003.m4s", http.StatusNotFound}, // Stream inexistente
+		{"/api/stream/abc/720p/segment3.m4s", http.StatusNotFound},   // Fora do padrão do muxer
+		{"/api/stream/abc/720p/segment003.mp4", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		reached := false
+		r := newValidateRouter(t, &reached)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, esperado %d", tt.path, w.Code, tt.want)
+		}
+		if reached {
+			t.Errorf("%s: chegou ao handler", tt.path)
+		}
+	}
+}
+
+func TestValidateRenditionAccepts(t *testing.T) {
+	paths := []string{
+		"/api/stream/abc/720p/segment003.m4s",
+		"/api/stream/abc/720p/segment1234.ts",
+		"/api/stream/abc/720p/init.mp4",
+		"/api/stream/abc/720p/init_720p.mp4",
+		"/api/stream/abc/720p/playlist.m3u8",
+		"/api/stream/abc/sub0/segment000.vtt",
+		"/api/stream/abc/thumbs/sprite000.jpg",
+		"/api/stream/abc/thumbs/thumbnails.vtt",
+	}
+
+	for _, path := range paths {
+		reached := false
+		r := newValidateRouter(t, &reached)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if w.Code != http.StatusOK || !reached {
+			t.Errorf("%s: status %d (handler alcançado: %v), esperado 200", path, w.Code, reached)
+		}
+	}
+}
+
+func TestSafeJoin(t *testing.T) {
+	base := filepath.Join("downloads", "abc", "hls")
+
+	tests := []struct {
+		elem []string
+		want string // "" = recusado
+	}{
+		{[]string{"720p", "segment003.m4s"}, filepath.Join(base, "720p", "segment003.m4s")},
+		{[]string{"720p", "playlist.m3u8"}, filepath.Join(base, "720p", "playlist.m3u8")},
+		// Elementos absolutos são juntados dentro da base, não substituem ela
+		{[]string{"/etc/passwd"}, filepath.Join(base, "etc", "passwd")},
+		{[]string{"720p", "sub/../segment000.ts"}, filepath.Join(base, "720p", "segment000.ts")},
+		{[]string{".."}, ""},
+		{[]string{"..", "hls2", "segment000.ts"}, ""},
+		{[]string{"720p", "../../segment000.ts"}, ""},
+		{[]string{"720p", "../../../../etc/passwd"}, ""},
+		{[]string{"720p/../..", "x"}, ""},
+		{[]string{"/../../etc/passwd"}, ""},
+	}
+
+	for _, tt := range tests {
+		got, ok := safeJoin(base, tt.elem...)
+		if tt.want == "" {
+			if ok {
+				t.Errorf("safeJoin(%q) = %q, esperado recusar", tt.elem, got)
+			}
+			continue
+		}
+		if !ok || got != tt.want {
+			t.Errorf("safeJoin(%q) = %q, %v; esperado %q", tt.elem, got, ok, tt.want)
+		}
+	}
+
+	// Antes da transcodificação o stream ainda não tem diretório HLS
+	for _, elem := range [][]string{{"720p", "playlist.m3u8"}, {"master.m3u8"}} {
+		if got, ok := safeJoin("", elem...); ok {
+			t.Errorf("safeJoin(\"\", %q) = %q, esperado recusar", elem, got)
+		}
+	}
+}
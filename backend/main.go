@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 
 	"webtorrent-player/handlers"
@@ -19,6 +20,45 @@ func main() {
 		log.Fatal("Erro ao criar diretório de downloads:", err)
 	}
 
+	// Pipeline de transcodificação: um FFmpeg por qualidade (padrão) ou um único para a escada
+	if pipeline := os.Getenv("TRANSCODE_PIPELINE"); pipeline != "" {
+		if err := torrent.SetTranscodePipeline(pipeline); err != nil {
+			log.Fatal("Erro na configuração:", err)
+		}
+	}
+
+	// Modo de transcodificação: todas as qualidades do início ao fim (padrão) ou sob demanda
+	if mode := os.Getenv("TRANSCODE_MODE"); mode != "" {
+		if err := torrent.SetTranscodeMode(mode); err != nil {
+			log.Fatal("Erro na configuração:", err)
+		}
+	}
+
+	// Orçamento de processos FFmpeg simultâneos (padrão: número de CPUs, mínimo 2; 0 = sem limite)
+	if value := os.Getenv("FFMPEG_MAX_JOBS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err == nil {
+			err = torrent.SetMaxFFmpegJobs(n)
+		}
+		if err != nil {
+			log.Fatal("Erro na configuração: FFMPEG_MAX_JOBS inválido: ", value)
+		}
+	}
+
+	// Formato dos segmentos de vídeo: mpegts (padrão) ou fmp4 (CMAF)
+	if format := os.Getenv("SEGMENT_FORMAT"); format != "" {
+		if err := torrent.SetSegmentFormat(format); err != nil {
+			log.Fatal("Erro na configuração:", err)
+		}
+	}
+
+	// Escada ABR, duração de segmento, GOP e áudio (JSON, recarregado quando o arquivo muda)
+	if path := os.Getenv("ENCODING_CONFIG"); path != "" {
+		if err := torrent.LoadEncodingConfig(path); err != nil {
+			log.Fatal("Erro na configuração de codificação:", err)
+		}
+	}
+
 	// Inicializar cliente de torrent
 	if err := torrent.InitClient(); err != nil {
 		log.Fatal("Erro ao inicializar cliente de torrent:", err)
@@ -42,18 +82,24 @@ func main() {
 	{
 		api.POST("/stream", handlers.StartStream)
 		api.GET("/stream/:id/status", handlers.GetStreamStatus)
+		// Status em tempo real (Server-Sent Events)
+		api.GET("/stream/:id/events", handlers.GetStreamEvents)
+		// Arquivos do torrent e troca do arquivo reproduzido
+		api.GET("/stream/:id/files", handlers.GetStreamFiles)
+		api.POST("/stream/:id/file", handlers.SelectStreamFile)
 		// Master playlist (ABR)
 		api.GET("/stream/:id/master.m3u8", handlers.GetPlaylist)
-		// Playlist de qualidade específica
-		api.GET("/stream/:id/:quality/playlist.m3u8", handlers.GetQualityPlaylist)
-		// Segmentos de qualidade específica (usando * para capturar subpath)
-		api.GET("/stream/:id/:quality/:segment", handlers.GetQualitySegment)
+		// Manifesto MPEG-DASH (mesmos segmentos CMAF do HLS, requer SEGMENT_FORMAT=fmp4)
+		api.GET("/stream/:id/manifest.mpd", handlers.GetDASHManifest)
+		// Playlist de qualidade específica (qualidade validada contra a escada do stream)
+		api.GET("/stream/:id/:quality/playlist.m3u8", handlers.ValidateRendition, handlers.GetQualityPlaylist)
+		// Segmentos de qualidade específica (nome validado contra o padrão do muxer)
+		api.GET("/stream/:id/:quality/:segment", handlers.ValidateRendition, handlers.GetQualitySegment)
 		api.DELETE("/stream/:id", handlers.StopStream)
+		// Fila do scheduler de FFmpeg (todos os streams): ADMIN_TOKEN ou apenas loopback
+		api.GET("/admin/ffmpeg", handlers.RequireAdmin(os.Getenv("ADMIN_TOKEN")), handlers.GetFFmpegQueue)
 	}
 
-	// Servir arquivos HLS
-	r.Static("/hls", "./downloads")
-
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -0,0 +1,217 @@
+package torrent
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// Modos da rendition de áudio multicanal (audio.surround na configuração)
+const (
+	SurroundOff         = "off"         // Só o áudio estéreo (padrão)
+	SurroundPassthrough = "passthrough" // AC-3/E-AC-3 copiados da fonte; demais codecs viram AAC 5.1
+	SurroundAAC         = "aac"         // Sempre AAC 5.1 (reproduzível também em navegadores)
+)
+
+// Grupos de áudio do master playlist
+const (
+	stereoGroup   = "audio"
+	surroundGroup = "surround"
+)
+
+// BANDWIDTH anunciado para faixas AAC estéreo copiadas da fonte
+const stereoPassthroughBitrate = "192k"
+
+// Codecs copiados sem reencodar no modo passthrough
+var surroundPassthroughCodecs = map[string]bool{"ac3": true, "eac3": true}
+
+// BANDWIDTH anunciado para faixas copiadas (o bitrate da fonte não é conhecido antes do mux)
+const surroundPassthroughBitrate = "640k"
+
+// Máximo de canais do AAC multicanal (7.1 vira 5.1, o layout que todo receiver entende)
+const surroundMaxChannels = 6
+
+// AudioRendition é uma faixa de áudio transcodificada em playlist própria
+// (<Name>/playlist.m3u8, sintetizada em writeVODPlaylists), referenciada por URI no master playlist
+type AudioRendition struct {
+	Name     string // Diretório e nome da rendition (ex: surround1)
+	Group    string // GROUP-ID do #EXT-X-MEDIA
+	Track    AudioTrackInfo
+	Codec    string // copy ou aac
+	Channels int
+	Bitrate  string // ex: "384k"
+}
+
+// displayName retorna o nome amigável da faixa (NAME no master playlist, Label no MPD):
+// o título da fonte ou o idioma, com o layout de canais nas renditions surround
+func (r AudioRendition) displayName() string {
+	name := r.Track.Title
+	if name == "" {
+		name = getLanguageName(r.Track.Language)
+	}
+	if r.Group == surroundGroup {
+		name = fmt.Sprintf("%s (%s)", name, channelLayoutName(r.Channels))
+	}
+	return name
+}
+
+// hlsCodec retorna o identificador RFC 6381 do áudio gerado (atributo CODECS)
+func (r AudioRendition) hlsCodec() string {
+	codec := r.Track.Codec
+	if r.Codec != "copy" {
+		codec = "aac"
+	}
+	switch codec {
+	case "ac3":
+		return "ac-3"
+	case "eac3":
+		return "ec-3"
+	default:
+		return "mp4a.40.2"
+	}
+}
+
+// channelLayoutName nomeia o layout de canais para o NAME da rendition
+func channelLayoutName(channels int) string {
+	switch channels {
+	case 6:
+		return "5.1"
+	case 8:
+		return "7.1"
+	default:
+		return fmt.Sprintf("%d canais", channels)
+	}
+}
+
+// stereoRenditions cria uma rendition estéreo por faixa de áudio da fonte.
+// Faixas já em AAC com até audio.channels canais são copiadas; as demais viram AAC.
+func stereoRenditions(cfg *EncodingConfig, tracks []AudioTrackInfo) []AudioRendition {
+	renditions := make([]AudioRendition, 0, len(tracks))
+	for _, track := range tracks {
+		r := AudioRendition{
+			Name:     fmt.Sprintf("audio%d", track.Index),
+			Group:    stereoGroup,
+			Track:    track,
+			Codec:    "aac",
+			Channels: cfg.Audio.Channels,
+			Bitrate:  cfg.Audio.Bitrate,
+		}
+		if remuxAudioCodecs[track.Codec] && track.Channels > 0 && track.Channels <= cfg.Audio.Channels {
+			r.Codec = "copy"
+			r.Channels = track.Channels
+			r.Bitrate = stereoPassthroughBitrate
+		}
+		renditions = append(renditions, r)
+	}
+	return renditions
+}
+
+// surroundRenditions escolhe as faixas multicanal (mais de 2 canais) que ganham uma
+// rendition surround, de acordo com audio.surround
+func surroundRenditions(cfg *EncodingConfig, tracks []AudioTrackInfo) []AudioRendition {
+	if cfg.Audio.Surround == "" || cfg.Audio.Surround == SurroundOff {
+		return nil
+	}
+
+	var renditions []AudioRendition
+	for _, track := range tracks {
+		if track.Channels <= 2 {
+			continue
+		}
+
+		r := AudioRendition{
+			Name:     fmt.Sprintf("surround%d", track.Index),
+			Group:    surroundGroup,
+			Track:    track,
+			Codec:    "aac",
+			Channels: track.Channels,
+			Bitrate:  cfg.Audio.SurroundBitrate,
+		}
+		if cfg.Audio.Surround == SurroundPassthrough && surroundPassthroughCodecs[track.Codec] {
+			r.Codec = "copy"
+			r.Bitrate = surroundPassthroughBitrate
+		} else if r.Channels > surroundMaxChannels {
+			r.Channels = surroundMaxChannels
+		}
+		renditions = append(renditions, r)
+	}
+	return renditions
+}
+
+// buildAudioArgs constrói o FFmpeg de uma rendition de áudio (sem vídeo)
+func buildAudioArgs(cfg *EncodingConfig, media mediaInfo, r AudioRendition, playlistPath, segmentPath string, seek seekPoint) []string {
+	args := ffmpegInputArgs(media.VideoFile, "", seek)
+	args = append(args, "-map", fmt.Sprintf("0:a:%d", r.Track.Index), "-vn", "-sn")
+
+	if r.Codec == "copy" {
+		args = append(args, "-c:a", "copy")
+	} else {
+		args = append(args,
+			"-c:a", "aac",
+			"-b:a", r.Bitrate,
+			"-ac", fmt.Sprintf("%d", r.Channels),
+			"-ar", fmt.Sprintf("%d", cfg.Audio.SampleRate),
+		)
+	}
+	args = append(args, "-metadata:s:a:0", fmt.Sprintf("language=%s", r.Track.Language))
+	if r.Track.Title != "" {
+		args = append(args, "-metadata:s:a:0", fmt.Sprintf("title=%s", r.Track.Title))
+	}
+
+	args = append(args, hlsOutputArgs(cfg, seek, "init.mp4")...)
+	return append(args,
+		"-hls_segment_filename", segmentPath,
+		"-f", "hls",
+		playlistPath,
+	)
+}
+
+// transcodeAudio inicia o FFmpeg de uma rendition de áudio a partir de seek
+func transcodeAudio(stream *StreamInfo, r AudioRendition, seek seekPoint) error {
+	hlsDir := stream.hlsDir()
+	dir := filepath.Join(hlsDir, r.Name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	args := buildAudioArgs(stream.encodingConfig(), stream.currentMedia(), r, filepath.Join(dir, encoderPlaylistName), segmentPattern(dir), seek)
+	if _, err := runFFmpegJob(stream, []string{r.Name}, args, hlsDir, seek.Time); err != nil {
+		return fmt.Errorf("erro ao iniciar FFmpeg: %v", err)
+	}
+
+	log.Printf("[%s] 🔈 %s: áudio %s %d canais (%s, %s) a partir de %.0fs",
+		stream.ID[:8], r.Name, r.Codec, r.Channels, r.Track.Language, r.Track.Codec, seek.Time)
+	return nil
+}
+
+// restartAudioAt substitui o FFmpeg de uma rendition de áudio por um novo começando em seek
+func restartAudioAt(stream *StreamInfo, r AudioRendition, seek seekPoint, done chan struct{}) error {
+	select {
+	case <-done:
+		return fmt.Errorf("cancelado")
+	default:
+	}
+
+	stream.killQualityCmd(r.Name)
+	return transcodeAudio(stream, r, seek)
+}
+
+// currentAudioRenditions retorna as renditions de áudio do arquivo atual
+func (s *StreamInfo) currentAudioRenditions() []AudioRendition {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.audioRenditions
+}
+
+// findAudioRendition busca uma rendition de áudio do arquivo atual pelo nome
+func (s *StreamInfo) findAudioRendition(name string) (AudioRendition, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.audioRenditions {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return AudioRendition{}, false
+}
@@ -0,0 +1,136 @@
+package torrent
+
+import (
+	"strings"
+	"testing"
+)
+
+// Faixas de uma fonte típica: AAC estéreo, AC-3 5.1, E-AC-3 7.1 e DTS 5.1
+var testAudioTracks = []AudioTrackInfo{
+	{Index: 0, Language: "por", Codec: "aac", Channels: 2},
+	{Index: 1, Language: "eng", Codec: "ac3", Channels: 6},
+	{Index: 2, Language: "eng", Codec: "eac3", Channels: 8, Title: "Atmos"},
+	{Index: 3, Language: "spa", Codec: "dts", Channels: 6},
+}
+
+func TestStereoRenditions(t *testing.T) {
+	cfg := defaultEncodingConfig()
+	want := []struct {
+		name     string
+		codec    string
+		channels int
+		bitrate  string
+	}{
+		{"audio0", "copy", 2, stereoPassthroughBitrate}, // AAC estéreo: remux
+		{"audio1", "aac", 2, "128k"},
+		{"audio2", "aac", 2, "128k"},
+		{"audio3", "aac", 2, "128k"},
+	}
+
+	renditions := stereoRenditions(cfg, testAudioTracks)
+	if len(renditions) != len(want) {
+		t.Fatalf("%d renditions, esperado %d", len(renditions), len(want))
+	}
+	for i, w := range want {
+		r := renditions[i]
+		if r.Name != w.name || r.Group != stereoGroup || r.Codec != w.codec || r.Channels != w.channels || r.Bitrate != w.bitrate {
+			t.Errorf("rendition %d = %+v, esperado %+v", i, r, w)
+		}
+	}
+}
+
+func TestSurroundRenditions(t *testing.T) {
+	type rendition struct {
+		name     string
+		codec    string
+		channels int
+		hlsCodec string
+	}
+	tests := []struct {
+		mode string
+		want []rendition
+	}{
+		{SurroundOff, nil},
+		{SurroundAAC, []rendition{
+			{"surround1", "aac", 6, "mp4a.40.2"},
+			{"surround2", "aac", 6, "mp4a.40.2"}, // 7.1 vira 5.1
+			{"surround3", "aac", 6, "mp4a.40.2"},
+		}},
+		{SurroundPassthrough, []rendition{
+			{"surround1", "copy", 6, "ac-3"},
+			{"surround2", "copy", 8, "ec-3"},
+			{"surround3", "aac", 6, "mp4a.40.2"}, // DTS não toca em navegador: AAC 5.1
+		}},
+	}
+	for _, tt := range tests {
+		cfg := defaultEncodingConfig()
+		cfg.Audio.Surround = tt.mode
+
+		renditions := surroundRenditions(cfg, testAudioTracks)
+		if len(renditions) != len(tt.want) {
+			t.Errorf("%s: %d renditions, esperado %d", tt.mode, len(renditions), len(tt.want))
+			continue
+		}
+		for i, w := range tt.want {
+			r := renditions[i]
+			got := rendition{r.Name, r.Codec, r.Channels, r.hlsCodec()}
+			if got != w || r.Group != surroundGroup {
+				t.Errorf("%s: rendition %d = %+v (%s), esperado %+v", tt.mode, i, got, r.Group, w)
+			}
+		}
+	}
+}
+
+func TestAudioDisplayName(t *testing.T) {
+	tests := []struct {
+		rendition AudioRendition
+		want      string
+	}{
+		{AudioRendition{Group: stereoGroup, Track: AudioTrackInfo{Language: "por"}}, "Português"},
+		{AudioRendition{Group: stereoGroup, Track: AudioTrackInfo{Language: "eng", Title: "Comentários"}}, "Comentários"},
+		{AudioRendition{Group: surroundGroup, Channels: 6, Track: AudioTrackInfo{Language: "eng"}}, "English (5.1)"},
+		{AudioRendition{Group: surroundGroup, Channels: 8, Track: AudioTrackInfo{Language: "eng", Title: "Atmos"}}, "Atmos (7.1)"},
+		{AudioRendition{Group: surroundGroup, Channels: 4, Track: AudioTrackInfo{Language: "eng"}}, "English (4 canais)"},
+	}
+	for _, tt := range tests {
+		if got := tt.rendition.displayName(); got != tt.want {
+			t.Errorf("displayName = %q, esperado %q", got, tt.want)
+		}
+	}
+}
+
+func TestBuildAudioArgs(t *testing.T) {
+	cfg := defaultEncodingConfig()
+	media := mediaInfo{VideoFile: "/downloads/filme.mkv"}
+
+	tests := []struct {
+		name      string
+		rendition AudioRendition
+		want      map[string]string
+	}{
+		{
+			"AAC estéreo reencodado",
+			AudioRendition{Name: "audio1", Codec: "aac", Channels: 2, Bitrate: "128k", Track: AudioTrackInfo{Index: 1, Language: "eng"}},
+			map[string]string{"-map": "0:a:1", "-c:a": "aac", "-b:a": "128k", "-ac": "2", "-ar": "48000"},
+		},
+		{
+			"AC-3 copiado",
+			AudioRendition{Name: "surround1", Codec: "copy", Channels: 6, Track: AudioTrackInfo{Index: 1, Language: "eng"}},
+			map[string]string{"-map": "0:a:1", "-c:a": "copy", "-b:a": "", "-ac": ""},
+		},
+	}
+	for _, tt := range tests {
+		args := buildAudioArgs(cfg, media, tt.rendition, "/hls/"+tt.rendition.Name+"/encoder.m3u8", "/hls/"+tt.rendition.Name+"/segment%03d.ts", seekPoint{})
+		for option, want := range tt.want {
+			if got := argValue(args, option); got != want {
+				t.Errorf("%s: %s = %q, esperado %q", tt.name, option, got, want)
+			}
+		}
+		if !strings.Contains(strings.Join(args, " "), "-vn -sn") {
+			t.Errorf("%s: rendition de áudio com vídeo ou legenda: %v", tt.name, args)
+		}
+		if args[len(args)-1] != "/hls/"+tt.rendition.Name+"/encoder.m3u8" {
+			t.Errorf("%s: saída %q", tt.name, args[len(args)-1])
+		}
+	}
+}
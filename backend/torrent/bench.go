@@ -0,0 +1,167 @@
+package torrent
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PipelineBenchResult é o custo medido de um pipeline de transcodificação
+type PipelineBenchResult struct {
+	Pipeline   string
+	Qualities  int
+	Processes  int
+	Wall       time.Duration // Tempo até todas as qualidades terminarem
+	CPU        time.Duration // user + system somado de todos os processos
+	Segments   int           // Segmentos gerados (todas as qualidades)
+	Misaligned string        // Primeira fronteira de segmento divergente entre qualidades ("" = alinhadas)
+}
+
+// Diferença máxima aceita entre fronteiras de segmento (EXTINF tem precisão de microssegundos)
+const segmentAlignmentTolerance = 0.001
+
+// BenchmarkPipeline transcodifica os primeiros seconds de inputFile para a escada da fonte
+// com o pipeline dado, escrevendo em outDir, e mede tempo e CPU gastos.
+// A variante "original" (remux) não entra na comparação: ela não decodifica a fonte.
+func BenchmarkPipeline(pipeline, inputFile string, seconds float64, outDir string) (PipelineBenchResult, error) {
+	sourceWidth, sourceHeight := getVideoResolution(inputFile)
+	if sourceHeight == 0 {
+		return PipelineBenchResult{}, fmt.Errorf("não foi possível ler a resolução de %s", inputFile)
+	}
+	cfg := currentEncodingConfig()
+	media := mediaInfo{
+		VideoFile:    inputFile,
+		SourceWidth:  sourceWidth,
+		SourceHeight: sourceHeight,
+		AudioTracks:  GetAudioTracksInfo(inputFile),
+		FrameRate:    getVideoFrameRate(inputFile),
+		Geometry:     getVideoGeometry(inputFile),
+	}
+	_, _, _, _, _, media.Color = GetVideoInfo(inputFile)
+	ladder := fitToSource(cfg.ladderFor(sourceHeight, "", ""), media)
+
+	// -t antes do -i limita a leitura da entrada
+	limit := []string{"-t", fmt.Sprintf("%.3f", seconds)}
+
+	var commands [][]string
+	switch pipeline {
+	case PipelinePerQuality:
+		for _, q := range ladder {
+			dir := filepath.Join(outDir, q.Name)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return PipelineBenchResult{}, err
+			}
+			args := buildFFmpegArgs(cfg, media, q, filepath.Join(dir, encoderPlaylistName), segmentPattern(dir), seekPoint{})
+			commands = append(commands, append(limit, args...))
+		}
+	case PipelineSingle:
+		for _, q := range ladder {
+			if err := os.MkdirAll(filepath.Join(outDir, q.Name), 0755); err != nil {
+				return PipelineBenchResult{}, err
+			}
+		}
+		args := buildLadderArgs(cfg, media, ladder, outDir, seekPoint{})
+		commands = append(commands, append(limit, args...))
+	default:
+		return PipelineBenchResult{}, fmt.Errorf("pipeline desconhecido: %s", pipeline)
+	}
+
+	result := PipelineBenchResult{Pipeline: pipeline, Qualities: len(ladder), Processes: len(commands)}
+
+	// Os processos rodam em paralelo, como no streaming
+	var (
+		wg       sync.WaitGroup
+		resMu    sync.Mutex
+		firstErr error
+	)
+	start := time.Now()
+	for _, args := range commands {
+		cmd := exec.Command("ffmpeg", args...)
+		if err := cmd.Start(); err != nil {
+			return result, fmt.Errorf("erro ao iniciar FFmpeg: %v", err)
+		}
+
+		wg.Add(1)
+		go func(cmd *exec.Cmd) {
+			defer wg.Done()
+			err := cmd.Wait()
+
+			resMu.Lock()
+			defer resMu.Unlock()
+			if err != nil && firstErr == nil {
+				firstErr = fmt.Errorf("FFmpeg falhou: %v", err)
+			}
+			if cmd.ProcessState != nil {
+				result.CPU += cmd.ProcessState.UserTime() + cmd.ProcessState.SystemTime()
+			}
+		}(cmd)
+	}
+	wg.Wait()
+	result.Wall = time.Since(start)
+
+	for _, q := range ladder {
+		result.Segments += countSegmentsInDir(filepath.Join(outDir, q.Name))
+	}
+	if firstErr == nil {
+		result.Misaligned = checkSegmentAlignment(outDir, ladder)
+	}
+
+	return result, firstErr
+}
+
+// checkSegmentAlignment compara as fronteiras dos segmentos de todas as qualidades
+// (somando as durações EXTINF da playlist gravada pelo FFmpeg, nos dois pipelines).
+// A troca de qualidade no player só é contínua se todas cortarem nos mesmos instantes.
+func checkSegmentAlignment(outDir string, ladder []QualityLevel) string {
+	var reference []float64
+	for i, q := range ladder {
+		boundaries, err := segmentBoundaries(filepath.Join(outDir, q.Name, encoderPlaylistName))
+		if err != nil {
+			return fmt.Sprintf("%s: %v", q.Name, err)
+		}
+		if i == 0 {
+			reference = boundaries
+			continue
+		}
+		if len(boundaries) != len(reference) {
+			return fmt.Sprintf("%s: %d segmentos, %s: %d", ladder[0].Name, len(reference), q.Name, len(boundaries))
+		}
+		for n := range boundaries {
+			if math.Abs(boundaries[n]-reference[n]) > segmentAlignmentTolerance {
+				return fmt.Sprintf("segmento %d termina em %.3fs em %s e em %.3fs em %s",
+					n, reference[n], ladder[0].Name, boundaries[n], q.Name)
+			}
+		}
+	}
+	return ""
+}
+
+// segmentBoundaries lê a playlist de mídia e retorna o instante final de cada segmento
+func segmentBoundaries(playlistPath string) ([]float64, error) {
+	data, err := os.ReadFile(playlistPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var boundaries []float64
+	var end float64
+	for _, line := range strings.Split(string(data), "\n") {
+		value, ok := strings.CutPrefix(strings.TrimSpace(line), "#EXTINF:")
+		if !ok {
+			continue
+		}
+		duration, err := strconv.ParseFloat(strings.TrimSuffix(value, ","), 64)
+		if err != nil {
+			return nil, fmt.Errorf("EXTINF inválido: %s", line)
+		}
+		end += duration
+		boundaries = append(boundaries, end)
+	}
+	return boundaries, nil
+}
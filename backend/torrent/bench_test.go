@@ -0,0 +1,224 @@
+package torrent
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestPlaylist grava em dir/<quality> a playlist do FFmpeg com as durações dadas
+func writeTestPlaylist(t *testing.T, dir, quality string, durations []float64) {
+	t.Helper()
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:3\n#EXT-X-MEDIA-SEQUENCE:0\n")
+	for n, d := range durations {
+		fmt.Fprintf(&b, "#EXTINF:%.6f,\nsegment%03d.ts\n", d, n)
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+
+	qualityDir := filepath.Join(dir, quality)
+	if err := os.MkdirAll(qualityDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(qualityDir, encoderPlaylistName), []byte(b.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSegmentBoundaries(t *testing.T) {
+	dir := t.TempDir()
+	writeTestPlaylist(t, dir, "360p", []float64{2.002, 2.002, 1.995})
+
+	boundaries, err := segmentBoundaries(filepath.Join(dir, "360p", encoderPlaylistName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{2.002, 4.004, 5.999}
+	if len(boundaries) != len(want) {
+		t.Fatalf("%d fronteiras, esperado %d", len(boundaries), len(want))
+	}
+	for n := range want {
+		if math.Abs(boundaries[n]-want[n]) > 1e-9 {
+			t.Errorf("fronteira %d = %f, esperado %f", n, boundaries[n], want[n])
+		}
+	}
+
+	if _, err := segmentBoundaries(filepath.Join(dir, "720p", encoderPlaylistName)); err == nil {
+		t.Error("playlist inexistente não retornou erro")
+	}
+}
+
+func TestCheckSegmentAlignment(t *testing.T) {
+	ladder := []QualityLevel{{Name: "360p"}, {Name: "720p"}}
+
+	tests := []struct {
+		name    string
+		low     []float64
+		high    []float64
+		aligned bool
+	}{
+		// 23,976fps: 48 frames = 2,002s por segmento, o último mais curto
+		{"alinhadas", []float64{2.002, 2.002, 2.002, 0.994}, []float64{2.002, 2.002, 2.002, 0.994}, true},
+		// Diferenças abaixo da precisão do EXTINF
+		{"tolerância", []float64{2.0020, 2.0020}, []float64{2.0024, 2.0019}, true},
+		// Keyframe natural antes do forçado: a fronteira desliza e não volta
+		{"desalinhadas", []float64{2.002, 2.002, 2.002}, []float64{2.002, 1.710, 2.294}, false},
+		{"contagem diferente", []float64{2.002, 2.002, 2.002}, []float64{2.002, 4.004}, false},
+	}
+
+	for _, tt := range tests {
+		dir := t.TempDir()
+		writeTestPlaylist(t, dir, "360p", tt.low)
+		writeTestPlaylist(t, dir, "720p", tt.high)
+
+		misaligned := checkSegmentAlignment(dir, ladder)
+		if tt.aligned && misaligned != "" {
+			t.Errorf("%s: %s", tt.name, misaligned)
+		}
+		if !tt.aligned && misaligned == "" {
+			t.Errorf("%s: desalinhamento não detectado", tt.name)
+		}
+	}
+}
+
+func TestGopFor(t *testing.T) {
+	tests := []struct {
+		gop       int
+		segment   int
+		frameRate float64
+		want      int
+	}{
+		{0, 2, 23.976, 48}, // 47,952 arredondado para cima
+		{0, 2, 24, 48},     // Exato: sem frame a mais por erro de ponto flutuante
+		{0, 2, 25, 50},
+		{0, 2, 29.97, 60}, // 59,94
+		{0, 2, 30000.0 / 1001, 60},
+		{0, 2, 59.94, 120},
+		{0, 2, 60, 120},
+		{0, 6, 23.976, 144}, // 143,856
+		{0, 2, 0, 48},       // Desconhecido: defaultFrameRate
+		{96, 2, 29.97, 96},  // GOP fixo na configuração
+	}
+
+	for _, tt := range tests {
+		cfg := &EncodingConfig{GOP: tt.gop, SegmentDuration: tt.segment}
+		if got := cfg.gopFor(tt.frameRate); got != tt.want {
+			t.Errorf("gopFor(%.3f) com GOP %d e segmentos de %ds = %d, esperado %d", tt.frameRate, tt.gop, tt.segment, got, tt.want)
+		}
+	}
+}
+
+// O limite natural do GOP nunca pode disparar antes do keyframe forçado na fronteira:
+// simula os quadros da fonte e confere a maior distância entre keyframes forçados
+func TestForcedKeyframesWithinGOP(t *testing.T) {
+	for _, frameRate := range []float64{24000.0 / 1001, 24, 25, 30000.0 / 1001, 30, 60000.0 / 1001, 60} {
+		for _, segment := range []int{2, 4, 6} {
+			cfg := &EncodingConfig{SegmentDuration: segment}
+			gop := cfg.gopFor(frameRate)
+
+			// expr:gte(t,n_forced*D): o primeiro quadro com t >= n*D vira keyframe
+			last, forced := 0, 1
+			for frame := 1; float64(frame)/frameRate < 600; frame++ {
+				if float64(frame)/frameRate < float64(forced*segment) {
+					continue
+				}
+				if frame-last > gop {
+					t.Fatalf("%.3ffps, segmentos de %ds: %d quadros entre keyframes forçados, GOP %d", frameRate, segment, frame-last, gop)
+				}
+				last = frame
+				forced++
+			}
+		}
+	}
+}
+
+// argValue retorna o valor da opção nos argumentos do FFmpeg ("" se ausente)
+func argValue(args []string, option string) string {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == option {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+func TestVideoCodecArgsKeyframes(t *testing.T) {
+	quality := QualityLevel{Name: "720p", Width: 1280, Height: 720, Bitrate: "2800k", MaxBitrate: "2996k", BufSize: "4200k", CRF: 24, Preset: "fast"}
+
+	tests := []struct {
+		frameRate float64
+		segment   int
+		spec      string
+		gop       string
+		forceKey  string
+	}{
+		{23.976, 2, "v", "48", "expr:gte(t,n_forced*2)"},
+		{29.97, 2, "v", "60", "expr:gte(t,n_forced*2)"},
+		{29.97, 4, "v:1", "120", "expr:gte(t,n_forced*4)"},
+		{25, 6, "v:0", "150", "expr:gte(t,n_forced*6)"},
+	}
+
+	for _, tt := range tests {
+		cfg := &EncodingConfig{SegmentDuration: tt.segment}
+		args := videoCodecArgs(cfg, "", quality, tt.frameRate, tt.spec)
+
+		checks := map[string]string{
+			"-g:" + tt.spec:                tt.gop,
+			"-keyint_min:" + tt.spec:       tt.gop,
+			"-sc_threshold:" + tt.spec:     "0",
+			"-force_key_frames:" + tt.spec: tt.forceKey,
+		}
+		for option, want := range checks {
+			if got := argValue(args, option); got != want {
+				t.Errorf("%.3ffps, segmentos de %ds: %s = %q, esperado %q", tt.frameRate, tt.segment, option, got, want)
+			}
+		}
+	}
+
+	// O remux segue os keyframes da fonte: nada forçado
+	args := videoCodecArgs(&EncodingConfig{SegmentDuration: 2}, "copy", QualityLevel{Name: "original", Copy: true}, 23.976, "v")
+	if got := argValue(args, "-force_key_frames:v"); got != "" {
+		t.Errorf("remux com force_key_frames %q", got)
+	}
+}
+
+// Transcodifica uma fonte sintética de 23,976fps com os dois pipelines e confere o alinhamento
+// real dos segmentos (só roda com ffmpeg/ffprobe instalados e sem -short)
+func TestBenchmarkPipelineAlignment(t *testing.T) {
+	if testing.Short() {
+		t.Skip("transcodificação real")
+	}
+	for _, tool := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s não encontrado", tool)
+		}
+	}
+
+	dir := t.TempDir()
+	input := filepath.Join(dir, "testsrc.mp4")
+	generate := exec.Command("ffmpeg", "-v", "error", "-y",
+		"-f", "lavfi", "-i", "testsrc2=size=640x360:rate=24000/1001",
+		"-t", "12", "-c:v", "libx264", "-preset", "ultrafast", "-pix_fmt", "yuv420p",
+		input)
+	if output, err := generate.CombinedOutput(); err != nil {
+		t.Fatalf("erro ao gerar a fonte: %v\n%s", err, output)
+	}
+
+	for _, pipeline := range []string{PipelinePerQuality, PipelineSingle} {
+		result, err := BenchmarkPipeline(pipeline, input, 12, filepath.Join(dir, pipeline))
+		if err != nil {
+			t.Fatalf("%s: %v", pipeline, err)
+		}
+		if result.Qualities < 2 {
+			t.Fatalf("%s: %d qualidades, esperado ao menos 2 para comparar", pipeline, result.Qualities)
+		}
+		if result.Misaligned != "" {
+			t.Errorf("%s: %s", pipeline, result.Misaligned)
+		}
+	}
+}
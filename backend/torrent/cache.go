@@ -12,6 +12,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/anacrolix/torrent"
 )
 
 // CacheEntry representa uma entrada no cache de metadados
@@ -141,13 +143,14 @@ func (c *MetadataCache) Set(magnetLink string, entry *CacheEntry) {
 
 // UpdateFromStream atualiza o cache a partir de um StreamInfo
 func (c *MetadataCache) UpdateFromStream(stream *StreamInfo, duration float64, videoCodec, audioCodec string, audioTracks, subtitleTracks int) {
+	media := stream.currentMedia()
 	entry := &CacheEntry{
-		Name:           stream.FileName,
-		FileName:       stream.FileName,
+		Name:           media.FileName,
+		FileName:       media.FileName,
 		FileSize:       0, // Será preenchido quando disponível
 		Duration:       duration,
-		Width:          stream.SourceWidth,
-		Height:         stream.SourceHeight,
+		Width:          media.SourceWidth,
+		Height:         media.SourceHeight,
 		VideoCodec:     videoCodec,
 		AudioCodec:     audioCodec,
 		AudioTracks:    audioTracks,
@@ -244,7 +247,7 @@ func (c *MetadataCache) Stats() (total int, hits int, avgAccess float64) {
 }
 
 // GetVideoInfo obtém informações do vídeo usando ffprobe (com cache)
-func GetVideoInfo(videoPath string) (duration float64, videoCodec, audioCodec string, audioTracks, subtitleTracks int) {
+func GetVideoInfo(videoPath string) (duration float64, videoCodec, audioCodec string, audioTracks, subtitleTracks int, color VideoColorInfo) {
 	// Duração
 	durationCmd := exec.Command("ffprobe",
 		"-v", "error",
@@ -256,16 +259,34 @@ func GetVideoInfo(videoPath string) (duration float64, videoCodec, audioCodec st
 		fmt.Sscanf(strings.TrimSpace(string(output)), "%f", &duration)
 	}
 	
-	// Codec de vídeo
+	// Codec e cor do vídeo (transferência/primárias indicam HDR; o side data, Dolby Vision)
 	videoCmd := exec.Command("ffprobe",
 		"-v", "error",
 		"-select_streams", "v:0",
-		"-show_entries", "stream=codec_name",
-		"-of", "default=noprint_wrappers=1:nokey=1",
+		"-show_entries", "stream=codec_name,color_transfer,color_primaries,color_space:stream_side_data=dv_profile",
+		"-of", "default=noprint_wrappers=1",
 		videoPath,
 	)
 	if output, err := videoCmd.Output(); err == nil {
-		videoCodec = strings.TrimSpace(string(output))
+		for _, line := range strings.Split(string(output), "\n") {
+			key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+			if !ok {
+				continue
+			}
+			switch key {
+			case "codec_name":
+				videoCodec = value
+			case "color_transfer":
+				color.Transfer = value
+			case "color_primaries":
+				color.Primaries = value
+			case "color_space":
+				color.Space = value
+			case "dv_profile":
+				fmt.Sscanf(value, "%d", &color.DVProfile)
+			}
+		}
+		color.HDRFormat = classifyHDR(color)
 	}
 	
 	// Codec de áudio
@@ -392,6 +413,116 @@ func GetAudioTracksInfo(videoPath string) []AudioTrackInfo {
 	return tracks
 }
 
+// SubtitleTrackInfo contém informações de uma faixa de legenda em texto
+type SubtitleTrackInfo struct {
+	Index       int    `json:"index"`       // Índice entre as legendas do arquivo (0:s:N)
+	StreamIndex int    `json:"streamIndex"` // Índice absoluto do stream
+	Language    string `json:"language"`    // Código do idioma (eng, por, jpn, etc)
+	Title       string `json:"title"`       // Nome/título da faixa
+	Codec       string `json:"codec"`       // Codec original (subrip, ass, mov_text...)
+	Default     bool   `json:"default"`     // Se é a legenda padrão
+	Forced      bool   `json:"forced"`      // Legenda forçada (apenas falas em outro idioma)
+	Rendition   string `json:"rendition"`   // Diretório da rendition WebVTT (sub0, sub1...)
+	Source      string `json:"source"`      // embedded (dentro do vídeo) ou sidecar (arquivo do torrent)
+	file        *torrent.File                // Arquivo de legenda externo (apenas sidecar)
+}
+
+// Codecs de legenda em texto que podem ser convertidos para WebVTT.
+// Legendas em imagem (PGS, VobSub) não são suportadas.
+var textSubtitleCodecs = map[string]bool{
+	"subrip":   true,
+	"srt":      true,
+	"ass":      true,
+	"ssa":      true,
+	"mov_text": true,
+	"webvtt":   true,
+	"text":     true,
+}
+
+// GetSubtitleTracksInfo obtém informações das faixas de legenda em texto
+func GetSubtitleTracksInfo(videoPath string) []SubtitleTrackInfo {
+	cmd := exec.Command("ffprobe",
+		"-v", "error",
+		"-select_streams", "s",
+		"-show_entries", "stream=index,codec_name:stream_disposition=default,forced:stream_tags=language,title",
+		"-of", "json",
+		videoPath,
+	)
+
+	output, err := cmd.Output()
+	if err != nil {
+		log.Printf("Erro ao obter faixas de legenda: %v", err)
+		return nil
+	}
+
+	tracks, err := parseSubtitleTracks(output)
+	if err != nil {
+		log.Printf("Erro ao parsear JSON do ffprobe: %v", err)
+		return nil
+	}
+
+	log.Printf("💬 Faixas de legenda em texto encontradas: %d", len(tracks))
+	for _, t := range tracks {
+		log.Printf("   - [%d] %s (%s) - %s", t.Index, t.Title, t.Language, t.Codec)
+	}
+
+	return tracks
+}
+
+// parseSubtitleTracks lê a saída JSON do ffprobe e mantém só as legendas em texto,
+// numerando as renditions na ordem em que aparecem (sub0, sub1...)
+func parseSubtitleTracks(output []byte) ([]SubtitleTrackInfo, error) {
+	var result struct {
+		Streams []struct {
+			Index       int    `json:"index"`
+			CodecName   string `json:"codec_name"`
+			Disposition struct {
+				Default int `json:"default"`
+				Forced  int `json:"forced"`
+			} `json:"disposition"`
+			Tags struct {
+				Language string `json:"language"`
+				Title    string `json:"title"`
+			} `json:"tags"`
+		} `json:"streams"`
+	}
+
+	if err := json.Unmarshal(output, &result); err != nil {
+		return nil, err
+	}
+
+	tracks := make([]SubtitleTrackInfo, 0, len(result.Streams))
+	for i, stream := range result.Streams {
+		if !textSubtitleCodecs[stream.CodecName] {
+			log.Printf("   - Legenda [%d] ignorada: codec %s não é texto", i, stream.CodecName)
+			continue
+		}
+
+		lang := stream.Tags.Language
+		if lang == "" {
+			lang = "und"
+		}
+
+		title := stream.Tags.Title
+		if title == "" {
+			title = getLanguageName(lang)
+		}
+
+		tracks = append(tracks, SubtitleTrackInfo{
+			Index:       i,
+			StreamIndex: stream.Index,
+			Language:    lang,
+			Title:       title,
+			Codec:       stream.CodecName,
+			Default:     stream.Disposition.Default == 1,
+			Forced:      stream.Disposition.Forced == 1,
+			Rendition:   fmt.Sprintf("sub%d", len(tracks)),
+			Source:      "embedded",
+		})
+	}
+	return tracks, nil
+}
+
 // getLanguageName retorna o nome do idioma a partir do código ISO
 func getLanguageName(code string) string {
 	languages := map[string]string{
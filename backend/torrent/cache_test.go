@@ -0,0 +1,37 @@
+package torrent
+
+import "testing"
+
+func TestParseSubtitleTracks(t *testing.T) {
+	// Saída do ffprobe -select_streams s: PGS e VobSub são imagem e ficam de fora
+	output := []byte(`{"streams": [
+		{"index": 2, "codec_name": "subrip", "disposition": {"default": 1, "forced": 0}, "tags": {"language": "por"}},
+		{"index": 3, "codec_name": "hdmv_pgs_subtitle", "disposition": {"default": 0, "forced": 0}, "tags": {"language": "eng"}},
+		{"index": 4, "codec_name": "ass", "disposition": {"default": 0, "forced": 1}, "tags": {"language": "eng", "title": "Placas"}},
+		{"index": 5, "codec_name": "dvd_subtitle", "disposition": {"default": 0, "forced": 0}, "tags": {}},
+		{"index": 6, "codec_name": "mov_text", "disposition": {"default": 0, "forced": 0}, "tags": {}}
+	]}`)
+
+	tracks, err := parseSubtitleTracks(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []SubtitleTrackInfo{
+		{Index: 0, StreamIndex: 2, Language: "por", Title: "Português", Codec: "subrip", Default: true, Rendition: "sub0", Source: "embedded"},
+		{Index: 2, StreamIndex: 4, Language: "eng", Title: "Placas", Codec: "ass", Forced: true, Rendition: "sub1", Source: "embedded"},
+		{Index: 4, StreamIndex: 6, Language: "und", Title: getLanguageName("und"), Codec: "mov_text", Rendition: "sub2", Source: "embedded"},
+	}
+	if len(tracks) != len(want) {
+		t.Fatalf("%d faixas, esperado %d: %+v", len(tracks), len(want), tracks)
+	}
+	for i := range want {
+		if tracks[i] != want[i] {
+			t.Errorf("faixa %d = %+v, esperado %+v", i, tracks[i], want[i])
+		}
+	}
+
+	if _, err := parseSubtitleTracks([]byte("não é json")); err == nil {
+		t.Error("saída inválida do ffprobe não retornou erro")
+	}
+}
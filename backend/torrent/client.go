@@ -2,7 +2,9 @@ package torrent
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -12,96 +14,126 @@ import (
 	"time"
 
 	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
 	"github.com/google/uuid"
 )
 
 var (
 	client     *torrent.Client
-	streams    = make(map[string]*StreamInfo)
+	streams    = make(map[string]*StreamInfo) // ID do stream -> stream
+	byHash     = make(map[string]string)      // Info hash -> ID do stream (um stream por torrent)
+	sessions   = make(map[string]viewerSession) // ID da sessão do espectador -> stream e limites pedidos
 	mu         sync.RWMutex
 	maxStreams = 2 // Máximo de streams simultâneos
 )
 
+// Sessão sem nenhuma requisição nesse intervalo é tratada como abandonada (aba fechada sem
+// DELETE) quando um stream novo precisa de vaga. O player consulta o status a cada segundo.
+const sessionIdleTimeout = 5 * time.Minute
+
 // QualityLevel define uma qualidade de vídeo para ABR
 type QualityLevel struct {
-	Name       string // 360p, 480p, 720p, 1080p
-	Width      int
-	Height     int
-	Bitrate    string // ex: "1000k"
-	MaxBitrate string // ex: "1200k"
-	BufSize    string // ex: "2000k"
-	AudioRate  string // ex: "96k", "128k"
-	CRF        int    // Qualidade (menor = melhor)
-	Preset     string // ultrafast, veryfast, fast, medium
+	Name       string `json:"name"`       // 360p, 480p, 720p, 1080p
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	Bitrate    string `json:"bitrate"`    // ex: "1000k"
+	MaxBitrate string `json:"maxBitrate"` // ex: "1200k"
+	BufSize    string `json:"bufSize"`    // ex: "2000k"
+	CRF        int    `json:"crf"`        // Qualidade (menor = melhor)
+	Preset     string `json:"preset"`     // ultrafast, veryfast, fast, medium
+	Copy       bool   `json:"-"`          // Remux: copia o vídeo da fonte sem reencodar
+	Codecs     string `json:"-"`          // CODECS do remux (perfil e nível da fonte)
 }
 
-// Níveis de qualidade estilo Netflix
+// Níveis de qualidade estilo Netflix (escada padrão, substituível por ENCODING_CONFIG)
 // 240p é ultra-rápido para início instantâneo em conexões lentas ou arquivos grandes
-var qualityLevels = []QualityLevel{
-	{Name: "240p", Width: 426, Height: 240, Bitrate: "400k", MaxBitrate: "428k", BufSize: "600k", AudioRate: "64k", CRF: 30, Preset: "ultrafast"},
-	{Name: "360p", Width: 640, Height: 360, Bitrate: "800k", MaxBitrate: "856k", BufSize: "1200k", AudioRate: "96k", CRF: 28, Preset: "ultrafast"},
-	{Name: "480p", Width: 854, Height: 480, Bitrate: "1400k", MaxBitrate: "1498k", BufSize: "2100k", AudioRate: "128k", CRF: 26, Preset: "veryfast"},
-	{Name: "720p", Width: 1280, Height: 720, Bitrate: "2800k", MaxBitrate: "2996k", BufSize: "4200k", AudioRate: "128k", CRF: 24, Preset: "fast"},
-	{Name: "1080p", Width: 1920, Height: 1080, Bitrate: "5000k", MaxBitrate: "5350k", BufSize: "7500k", AudioRate: "192k", CRF: 22, Preset: "fast"},
+var defaultQualityLevels = []QualityLevel{
+	{Name: "240p", Width: 426, Height: 240, Bitrate: "400k", MaxBitrate: "428k", BufSize: "600k", CRF: 30, Preset: "ultrafast"},
+	{Name: "360p", Width: 640, Height: 360, Bitrate: "800k", MaxBitrate: "856k", BufSize: "1200k", CRF: 28, Preset: "ultrafast"},
+	{Name: "480p", Width: 854, Height: 480, Bitrate: "1400k", MaxBitrate: "1498k", BufSize: "2100k", CRF: 26, Preset: "veryfast"},
+	{Name: "720p", Width: 1280, Height: 720, Bitrate: "2800k", MaxBitrate: "2996k", BufSize: "4200k", CRF: 24, Preset: "fast"},
+	{Name: "1080p", Width: 1920, Height: 1080, Bitrate: "5000k", MaxBitrate: "5350k", BufSize: "7500k", CRF: 22, Preset: "fast"},
 	// Qualidades mais altas (exigem bastante CPU/GPU, especialmente em tempo real)
-	{Name: "1440p", Width: 2560, Height: 1440, Bitrate: "9000k", MaxBitrate: "9630k", BufSize: "13500k", AudioRate: "192k", CRF: 21, Preset: "fast"},
-	{Name: "2160p", Width: 3840, Height: 2160, Bitrate: "16000k", MaxBitrate: "17120k", BufSize: "24000k", AudioRate: "256k", CRF: 20, Preset: "fast"},
+	{Name: "1440p", Width: 2560, Height: 1440, Bitrate: "9000k", MaxBitrate: "9630k", BufSize: "13500k", CRF: 21, Preset: "fast"},
+	{Name: "2160p", Width: 3840, Height: 2160, Bitrate: "16000k", MaxBitrate: "17120k", BufSize: "24000k", CRF: 20, Preset: "fast"},
 }
 
 type StreamInfo struct {
 	ID             string            `json:"id"`
+	InfoHash       string            `json:"infoHash"`
 	MagnetLink     string            `json:"magnetLink"`
-	Status         string            `json:"status"` // downloading, transcoding, ready, error
-	Progress       float64           `json:"progress"`
-	FileName       string            `json:"fileName"`
-	VideoFile      string            `json:"videoFile"`
-	HLSPath        string            `json:"hlsPath"`
-	Error          string            `json:"error,omitempty"`
 	Peers          int               `json:"peers"`
 	DownloadRate   float64           `json:"downloadRate"`
 	CreatedAt      time.Time         `json:"createdAt"`
-	Qualities      []string          `json:"qualities"`    // Qualidades disponíveis
-	SourceWidth    int               `json:"sourceWidth"`
-	SourceHeight   int               `json:"sourceHeight"`
-	AudioTracks    []AudioTrackInfo  `json:"audioTracks"`  // Faixas de áudio disponíveis
+	// Estado mutável: protegido por mu, lido via Snapshot() (ver state.go)
+	state          StreamState
+	progress       float64
+	errMsg         string
+	qualities      []string  // Qualidades disponíveis
+	hlsPath        string
+	media          mediaInfo // Arquivo sendo reproduzido
 	torrent        *torrent.Torrent
+	metaInfo       *metainfo.MetaInfo // Preenchido quando o stream vem de um arquivo .torrent
+	requestedFile  *int               // Arquivo pedido pelo cliente (nil = maior vídeo)
 	cancelChan     chan struct{}
+	fileDone       chan struct{} // Cancela o pipeline do arquivo atual (troca de arquivo)
+	sidecars       []*torrent.File // Legendas externas do arquivo atual
 	ffmpegProcs    []*exec.Cmd
-	// Tracking de velocidade
+	viewers        int // Sessões de espectadores ligadas ao stream (protegido por mu global)
+	ladder         []QualityLevel         // Qualidades sendo geradas para o arquivo atual
+	audioRenditions []AudioRendition      // Faixas de áudio com playlist própria (surround)
+	vodPlaylists   bool                   // Playlists VOD sintetizadas para o arquivo atual (ver writeVODPlaylists)
+	thumbnails     *thumbnailSet          // Miniaturas do seek bar do arquivo atual (nil = sem)
+	encoding       *EncodingConfig        // Configuração com que o arquivo atual está sendo transcodificado
+	minQuality     string                 // Limites de qualidade pedidos pelo cliente ("" = sem limite)
+	maxQuality     string
+	qualityCmds    map[string]*exec.Cmd   // Processo FFmpeg atual de cada qualidade
+	jobs           map[string]*qualityJob // Progresso do job FFmpeg atual de cada qualidade
+	readahead      int64                  // Offset (bytes, relativo ao arquivo) da janela de prioridade
+	seeks          map[string]seekRequest // Último seek disparado por qualidade
+	requests       map[string]seekRequest // Último segmento pedido pelo player em cada rendition
+	resumes        map[string]resumeRecord // Retomadas seguidas de cada rendition (supervisor)
+	// Tracking de velocidade (amostrado por sampleStats)
 	lastBytes      int64
 	lastSpeedCheck time.Time
 	currentSpeed   float64 // MB/s instantâneo
+	currentPeers   int
+	downloadedMB   float64
+	subscribers    map[chan StreamEvent]struct{} // Assinantes de eventos (SSE)
 	mu             sync.Mutex
 }
 
-// GetPeerStats retorna estatísticas de peers e velocidade
-func (s *StreamInfo) GetPeerStats() (peers int, downloaded float64, speed float64) {
-	if s.torrent == nil {
-		return 0, 0, 0
-	}
-	
-	stats := s.torrent.Stats()
-	currentBytes := stats.BytesReadData.Int64()
-	downloaded = float64(currentBytes) / 1024 / 1024 // MB total baixados
-	
+// cancel sinaliza o fim do stream e do pipeline do arquivo atual
+func (s *StreamInfo) cancel() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	
-	now := time.Now()
-	if !s.lastSpeedCheck.IsZero() {
-		elapsed := now.Sub(s.lastSpeedCheck).Seconds()
-		if elapsed > 0.5 { // Atualizar a cada 500ms
-			bytesDiff := currentBytes - s.lastBytes
-			s.currentSpeed = float64(bytesDiff) / 1024 / 1024 / elapsed // MB/s
-			s.lastBytes = currentBytes
-			s.lastSpeedCheck = now
+
+	for _, ch := range []chan struct{}{s.cancelChan, s.fileDone} {
+		if ch == nil {
+			continue
+		}
+		select {
+		case <-ch:
+			// Já fechado
+		default:
+			close(ch)
 		}
-	} else {
-		s.lastBytes = currentBytes
-		s.lastSpeedCheck = now
 	}
-	
-	return stats.ActivePeers, downloaded, s.currentSpeed
+}
+
+// trackFFmpeg registra um processo FFmpeg do stream (encerrado ao parar/trocar de arquivo)
+func (s *StreamInfo) trackFFmpeg(cmd *exec.Cmd) {
+	mu.Lock()
+	s.ffmpegProcs = append(s.ffmpegProcs, cmd)
+	mu.Unlock()
+}
+
+// GetPeerStats retorna estatísticas de peers e velocidade.
+// Os valores são amostrados a cada segundo por sampleStats, não a cada consulta.
+func (s *StreamInfo) GetPeerStats() (peers int, downloaded float64, speed float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.currentPeers, s.downloadedMB, s.currentSpeed
 }
 
 // Hardware acceleration detection
@@ -205,7 +237,89 @@ func isHex(s string) bool {
 	return true
 }
 
-func StartStream(magnetLink string) (*StreamInfo, error) {
+// LoadTorrentFile lê e valida o conteúdo de um arquivo .torrent
+func LoadTorrentFile(r io.Reader) (*metainfo.MetaInfo, error) {
+	mi, err := metainfo.Load(r)
+	if err != nil {
+		return nil, fmt.Errorf("arquivo .torrent inválido: %w", err)
+	}
+
+	// Validar o dicionário info já aqui para falhar cedo (antes de criar o stream)
+	if _, err := mi.UnmarshalInfo(); err != nil {
+		return nil, fmt.Errorf("metadados do .torrent inválidos: %w", err)
+	}
+
+	return mi, nil
+}
+
+// StreamOptions são as opções escolhidas pelo cliente ao iniciar um stream
+type StreamOptions struct {
+	FileIndex  *int   // Arquivo do torrent a reproduzir (nil = maior vídeo)
+	MinQuality string // Menor qualidade da escada ("" = sem limite)
+	MaxQuality string // Maior qualidade da escada ("" = sem limite)
+}
+
+// Erros de StartStream/StopStream/SelectFile que são do pedido do cliente (não do servidor)
+var (
+	ErrInvalidMagnet  = errors.New("magnet link inválido")
+	ErrViewerConflict = errors.New("stream já em andamento")
+	ErrStopBySession  = errors.New("o stream é compartilhado: encerre pelo ID da sessão do espectador")
+	ErrStreamLimit    = errors.New("limite de streams simultâneos atingido")
+)
+
+// viewerSession liga a sessão de um espectador ao stream, com os limites de qualidade que ele pediu
+type viewerSession struct {
+	StreamID   string
+	MinQuality string
+	MaxQuality string
+	LastSeen   time.Time // Última requisição com o ID da sessão (ver GetStream)
+}
+
+// Viewer é a sessão de um espectador. Vários espectadores do mesmo info hash
+// compartilham o mesmo StreamInfo (torrent, FFmpeg e HLS).
+type Viewer struct {
+	ID     string
+	Stream *StreamInfo
+	Joined bool // true se entrou em um stream que já estava em andamento
+}
+
+func StartStream(magnetLink string, opts StreamOptions) (*Viewer, error) {
+	m, err := metainfo.ParseMagnetUri(magnetLink)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMagnet, err)
+	}
+	return startStream(magnetLink, m.InfoHash.HexString(), nil, opts)
+}
+
+// StartStreamFromTorrent inicia um stream a partir de um arquivo .torrent já carregado.
+// Como o dicionário info já está disponível, não é preciso esperar metadados dos peers.
+func StartStreamFromTorrent(mi *metainfo.MetaInfo, opts StreamOptions) (*Viewer, error) {
+	info, err := mi.UnmarshalInfo()
+	if err != nil {
+		return nil, fmt.Errorf("metadados do .torrent inválidos: %w", err)
+	}
+
+	// Magnet equivalente, usado como chave do cache de metadados e para exibição
+	infoHash := mi.HashInfoBytes()
+	magnetLink := mi.Magnet(&infoHash, &info).String()
+
+	return startStream(magnetLink, infoHash.HexString(), mi, opts)
+}
+
+func startStream(magnetLink, infoHash string, mi *metainfo.MetaInfo, opts StreamOptions) (*Viewer, error) {
+	infoHash = strings.ToLower(infoHash)
+	sessionID := uuid.New().String()
+
+	mu.Lock()
+
+	// Já existe um stream deste torrent: o espectador entra nele em vez de baixar/transcodificar de novo
+	if existingID, ok := byHash[infoHash]; ok {
+		viewer, err := joinStreamLocked(streams[existingID], sessionID, opts)
+		mu.Unlock()
+		return viewer, err
+	}
+	mu.Unlock()
+
 	streamID := uuid.New().String()
 	
 	// Verificar se já temos cache deste magnet
@@ -215,144 +329,297 @@ func StartStream(magnetLink string) (*StreamInfo, error) {
 	
 	stream := &StreamInfo{
 		ID:         streamID,
+		InfoHash:   infoHash,
 		MagnetLink: magnetLink,
-		Status:     "downloading",
-		Progress:   0,
 		CreatedAt:  time.Now(),
-		cancelChan: make(chan struct{}),
+		state:      StateDownloading,
+		media:      mediaInfo{FileIndex: -1},
+		metaInfo:      mi,
+		requestedFile: opts.FileIndex,
+		minQuality:    opts.MinQuality,
+		maxQuality:    opts.MaxQuality,
+		cancelChan:    make(chan struct{}),
 	}
 	
 	mu.Lock()
+
+	// Outro espectador pode ter criado o stream enquanto o lock estava livre
+	if existingID, ok := byHash[infoHash]; ok {
+		viewer, err := joinStreamLocked(streams[existingID], sessionID, opts)
+		mu.Unlock()
+		return viewer, err
+	}
 	
-	// Se já temos o máximo de streams, remover o mais antigo
+	// Se já temos o máximo de streams, remover o mais antigo sem espectadores (sessões
+	// abandonadas não contam). Streams assistidos não são derrubados: sem nenhum livre,
+	// o novo stream é recusado.
 	if len(streams) >= maxStreams {
-		var oldestID string
-		var oldestTime time.Time
+		oldStream := oldestEvictableLocked()
+		if oldStream == nil {
+			mu.Unlock()
+			return nil, fmt.Errorf("%w (%d), todos com espectadores", ErrStreamLimit, maxStreams)
+		}
+		oldestID := oldStream.ID
+		log.Printf("[%s] Removendo stream antigo para liberar espaço (limite: %d)", oldestID[:8], maxStreams)
 		
-		for id, s := range streams {
-			if oldestID == "" || s.CreatedAt.Before(oldestTime) {
-				oldestID = id
-				oldestTime = s.CreatedAt
-			}
+		// Fechar canais de cancelamento de forma segura
+		oldStream.cancel()
+		
+		// Parar processos FFmpeg primeiro
+		for _, proc := range oldStream.ffmpegProcs {
+			stopFFmpeg(proc)
 		}
 		
-		if oldestID != "" {
-			oldStream := streams[oldestID]
-			log.Printf("[%s] Removendo stream antigo para liberar espaço (limite: %d)", oldestID[:8], maxStreams)
-			
-			// Fechar canal de cancelamento de forma segura
-			select {
-			case <-oldStream.cancelChan:
-				// Já está fechado
-			default:
-				close(oldStream.cancelChan)
-			}
-			
-			// Parar processos FFmpeg primeiro
-			for _, proc := range oldStream.ffmpegProcs {
-				if proc != nil && proc.Process != nil {
-					proc.Process.Kill()
-				}
-			}
-			
-			// Remover torrent de forma segura
-			if oldStream.torrent != nil {
-				func() {
-					defer func() {
-						if r := recover(); r != nil {
-							log.Printf("[%s] Torrent já fechado: %v", oldestID[:8], r)
-						}
-					}()
-					oldStream.torrent.Drop()
+		// Remover torrent de forma segura
+		if oldStream.torrent != nil {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						log.Printf("[%s] Torrent já fechado: %v", oldestID[:8], r)
+					}
 				}()
+				oldStream.torrent.Drop()
+			}()
+		}
+		
+		// Limpar arquivos do stream antigo
+		hlsDir := filepath.Join("./downloads", oldestID)
+		os.RemoveAll(hlsDir)
+		
+		// Limpar também o diretório do torrent se existir
+		if videoPath := oldStream.currentMedia().VideoFile; videoPath != "" {
+			// Pegar o diretório pai do arquivo de vídeo (pasta do torrent)
+			torrentDir := filepath.Dir(videoPath)
+			if torrentDir != "./downloads" && torrentDir != "downloads" {
+				os.RemoveAll(torrentDir)
 			}
-			
-			// Limpar arquivos do stream antigo
-			hlsDir := filepath.Join("./downloads", oldestID)
-			os.RemoveAll(hlsDir)
-			
-			// Limpar também o diretório do torrent se existir
-			if oldStream.VideoFile != "" {
-				// Pegar o diretório pai do arquivo de vídeo (pasta do torrent)
-				torrentDir := filepath.Dir(oldStream.VideoFile)
-				if torrentDir != "./downloads" && torrentDir != "downloads" {
-					os.RemoveAll(torrentDir)
-				}
-			}
-			
-			delete(streams, oldestID)
-			log.Printf("[%s] Stream antigo removido com sucesso", oldestID[:8])
 		}
+		
+		forgetStreamLocked(oldStream)
+		log.Printf("[%s] Stream antigo removido com sucesso", oldestID[:8])
 	}
 	
 	streams[streamID] = stream
+	byHash[infoHash] = streamID
+	sessions[sessionID] = viewerSession{StreamID: streamID, MinQuality: opts.MinQuality, MaxQuality: opts.MaxQuality, LastSeen: time.Now()}
+	stream.viewers = 1
 	mu.Unlock()
 	
 	// Iniciar download em goroutine
 	go downloadAndTranscode(stream)
+	go sampleStats(stream)
 	
-	return stream, nil
+	return &Viewer{ID: sessionID, Stream: stream}, nil
+}
+
+// joinStreamLocked liga uma nova sessão a um stream existente (requer mu).
+// Como o torrent é compartilhado, não é possível atender a um pedido de outro arquivo.
+// A escada também é compartilhada: os limites de qualidade de quem entra depois filtram as
+// variantes que ele recebe (ver ViewerLadder), desde que se cruzem com os de quem começou.
+func joinStreamLocked(existing *StreamInfo, sessionID string, opts StreamOptions) (*Viewer, error) {
+	existing.mu.Lock()
+	current := existing.media.FileIndex
+	if current < 0 && existing.requestedFile != nil {
+		current = *existing.requestedFile
+	}
+	existing.mu.Unlock()
+
+	if opts.FileIndex != nil && current >= 0 && current != *opts.FileIndex {
+		return nil, fmt.Errorf("%w: este torrent já está sendo reproduzido com outro arquivo (%d)", ErrViewerConflict, current)
+	}
+
+	if !qualityRangesOverlap(existing.minQuality, existing.maxQuality, opts.MinQuality, opts.MaxQuality) {
+		return nil, fmt.Errorf("%w: as qualidades deste torrent estão limitadas a %s-%s",
+			ErrViewerConflict, orDefault(existing.minQuality, "mínima"), orDefault(existing.maxQuality, "máxima"))
+	}
+
+	sessions[sessionID] = viewerSession{StreamID: existing.ID, MinQuality: opts.MinQuality, MaxQuality: opts.MaxQuality, LastSeen: time.Now()}
+	existing.viewers++
+
+	log.Printf("[%s] 👥 Novo espectador no stream existente (%d espectadores)", existing.ID[:8], existing.viewers)
+	return &Viewer{ID: sessionID, Stream: existing, Joined: true}, nil
+}
+
+// oldestEvictableLocked encerra as sessões ociosas há mais de sessionIdleTimeout e retorna
+// o stream mais antigo que ficou sem espectadores, ou nil (requer mu)
+func oldestEvictableLocked() *StreamInfo {
+	for id, session := range sessions {
+		if time.Since(session.LastSeen) <= sessionIdleTimeout {
+			continue
+		}
+		delete(sessions, id)
+		if stream, ok := streams[session.StreamID]; ok && stream.viewers > 0 {
+			stream.viewers--
+			log.Printf("[%s] 💤 Sessão sem atividade há %s encerrada (%d espectadores restantes)",
+				stream.ID[:8], time.Since(session.LastSeen).Round(time.Second), stream.viewers)
+		}
+	}
+
+	var oldest *StreamInfo
+	for _, s := range streams {
+		if s.viewers > 0 {
+			continue
+		}
+		if oldest == nil || s.CreatedAt.Before(oldest.CreatedAt) {
+			oldest = s
+		}
+	}
+	return oldest
+}
+
+// forgetStreamLocked remove o stream e as sessões ligadas a ele dos índices (requer mu)
+func forgetStreamLocked(stream *StreamInfo) {
+	delete(streams, stream.ID)
+	if byHash[stream.InfoHash] == stream.ID {
+		delete(byHash, stream.InfoHash)
+	}
+	for sessionID, session := range sessions {
+		if session.StreamID == stream.ID {
+			delete(sessions, sessionID)
+		}
+	}
+}
+
+// Viewers retorna quantos espectadores estão ligados ao stream
+func (s *StreamInfo) Viewers() int {
+	mu.RLock()
+	defer mu.RUnlock()
+	return s.viewers
+}
+
+// qualityRangesOverlap informa se dois pares de limites de qualidade têm alturas em comum
+func qualityRangesOverlap(minA, maxA, minB, maxB string) bool {
+	cfg := currentEncodingConfig()
+	lowA, highA := cfg.heightLimits(minA, maxA)
+	lowB, highB := cfg.heightLimits(minB, maxB)
+
+	low, high := lowA, highA
+	if lowB > low {
+		low = lowB
+	}
+	if high == 0 || (highB > 0 && highB < high) {
+		high = highB
+	}
+	return high == 0 || low <= high
+}
+
+// orDefault retorna s, ou fallback se s estiver vazio
+func orDefault(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+// ViewerLadder retorna as qualidades da escada compartilhada dentro dos limites pedidos pela
+// sessão id (a escada inteira para o ID do stream ou uma sessão sem limites).
+// Se nenhuma couber, fica a menor, como em ladderFor.
+func (s *StreamInfo) ViewerLadder(id string) []QualityLevel {
+	mu.RLock()
+	session, ok := sessions[id]
+	mu.RUnlock()
+
+	ladder := s.currentLadder()
+	if !ok || session.StreamID != s.ID || (session.MinQuality == "" && session.MaxQuality == "") {
+		return ladder
+	}
+
+	// Alturas nominais da configuração (fitToSource ajusta as da escada à proporção da fonte)
+	cfg := s.encodingConfig()
+	minHeight, maxHeight := cfg.heightLimits(session.MinQuality, session.MaxQuality)
+	sourceHeight := s.currentMedia().SourceHeight
+
+	var filtered []QualityLevel
+	for _, q := range ladder {
+		height := q.Height
+		if q.Copy {
+			height = sourceHeight
+		} else if nominal, ok := cfg.findQuality(q.Name); ok {
+			height = nominal.Height
+		}
+		if height < minHeight || (maxHeight > 0 && height > maxHeight) {
+			continue
+		}
+		filtered = append(filtered, q)
+	}
+	if len(filtered) == 0 && len(ladder) > 0 {
+		return ladder[:1]
+	}
+	return filtered
 }
 
 func downloadAndTranscode(stream *StreamInfo) {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("Panic recuperado em downloadAndTranscode: %v", r)
-			stream.Status = "error"
-			stream.Error = fmt.Sprintf("Erro interno: %v", r)
+			stream.fail("Erro interno: %v", r)
 		}
 	}()
 
-	// Adicionar torrent
-	t, err := client.AddMagnet(stream.MagnetLink)
-	if err != nil {
-		stream.Status = "error"
-		stream.Error = fmt.Sprintf("Erro ao adicionar magnet: %v", err)
-		return
-	}
-	stream.torrent = t
-
-	log.Printf("[%s] Aguardando metadados do torrent...", stream.ID[:8])
+	if stream.metaInfo != nil {
+		// Arquivo .torrent: o info já está no metainfo, então não há espera por GotInfo()
+		t, err := client.AddTorrent(stream.metaInfo)
+		if err != nil {
+			stream.fail("Erro ao adicionar .torrent: %v", err)
+			return
+		}
+		stream.mu.Lock()
+		stream.torrent = t
+		stream.mu.Unlock()
+		log.Printf("[%s] Torrent carregado de arquivo: %s", stream.ID[:8], t.Name())
+	} else {
+		// Adicionar torrent
+		t, err := client.AddMagnet(stream.MagnetLink)
+		if err != nil {
+			stream.fail("Erro ao adicionar magnet: %v", err)
+			return
+		}
+		stream.mu.Lock()
+		stream.torrent = t
+		stream.mu.Unlock()
 
-	// Aguardar metadados com timeout
-	select {
-	case <-t.GotInfo():
-		log.Printf("[%s] Metadados recebidos: %s", stream.ID[:8], t.Name())
-	case <-time.After(60 * time.Second):
-		stream.Status = "error"
-		stream.Error = "Timeout ao obter metadados do torrent"
-		return
-	case <-stream.cancelChan:
-		return
-	}
+		log.Printf("[%s] Aguardando metadados do torrent...", stream.ID[:8])
 
-	// Encontrar arquivo de vídeo
-	var videoFile *torrent.File
-	videoExtensions := []string{".mp4", ".mkv", ".avi", ".mov", ".wmv", ".webm"}
-	
-	for _, file := range t.Files() {
-		for _, ext := range videoExtensions {
-			if strings.HasSuffix(strings.ToLower(file.Path()), ext) {
-				if videoFile == nil || file.Length() > videoFile.Length() {
-					videoFile = file
-				}
-			}
+		// Aguardar metadados com timeout
+		select {
+		case <-t.GotInfo():
+			log.Printf("[%s] Metadados recebidos: %s", stream.ID[:8], t.Name())
+		case <-time.After(60 * time.Second):
+			stream.fail("Timeout ao obter metadados do torrent")
+			return
+		case <-stream.cancelChan:
+			return
 		}
 	}
+	t := stream.torrent
 
-	if videoFile == nil {
-		stream.Status = "error"
-		stream.Error = "Nenhum arquivo de vídeo encontrado no torrent"
+	// Encontrar arquivo de vídeo (o pedido pelo cliente ou o maior)
+	videoFile, fileIndex, err := pickVideoFile(t, stream.requestedFile)
+	if err != nil {
+		stream.fail("%v", err)
 		return
 	}
 
-	stream.FileName = filepath.Base(videoFile.Path())
+	done := stream.selectFile(videoFile, fileIndex)
+	playFile(stream, videoFile, done)
+}
+
+// playFile baixa e transcodifica o arquivo escolhido até o download terminar
+// ou o pipeline ser cancelado (stream parado ou troca de arquivo)
+func playFile(stream *StreamInfo, videoFile *torrent.File, done chan struct{}) {
+	t := stream.torrent
+
+	fileName := filepath.Base(videoFile.Path())
 	// O anacrolix/torrent baixa para ./downloads/NOME_DO_TORRENT/arquivo
 	// O videoFile.Path() já contém o caminho completo desde a raiz do torrent
-	stream.VideoFile = filepath.Join("./downloads", videoFile.Path())
+	videoPath := filepath.Join("./downloads", videoFile.Path())
+	stream.updateMedia(func(m *mediaInfo) {
+		m.FileName = fileName
+		m.VideoFile = videoPath
+	})
 	
-	log.Printf("[%s] Baixando: %s (%.2f MB)", stream.ID[:8], stream.FileName, float64(videoFile.Length())/1024/1024)
-	log.Printf("[%s] Caminho do arquivo: %s", stream.ID[:8], stream.VideoFile)
+	log.Printf("[%s] Baixando: %s (%.2f MB)", stream.ID[:8], fileName, float64(videoFile.Length())/1024/1024)
+	log.Printf("[%s] Caminho do arquivo: %s", stream.ID[:8], videoPath)
 
 	// IMPORTANTE: Para MKV/MP4, os headers estão no início do arquivo
 	// Precisamos baixar os primeiros MB de forma sequencial antes de iniciar transcodificação
@@ -361,7 +628,7 @@ func downloadAndTranscode(stream *StreamInfo) {
 	videoFile.Download()
 
 	// OTIMIZAÇÃO: Priorização sequencial inteligente
-	go monitorAndPrioritizePieces(stream, videoFile)
+	go monitorAndPrioritizePieces(stream, videoFile, done)
 	
 	// Priorizar um bloco inicial maior para garantir que os headers E os primeiros segundos
 	// do arquivo estejam realmente disponíveis (evita o FFmpeg ler "buracos"/zeros e gerar
@@ -400,13 +667,13 @@ func downloadAndTranscode(stream *StreamInfo) {
 
 	for {
 		select {
-		case <-stream.cancelChan:
+		case <-done:
 			return
 		case <-ticker.C:
 			bytesCompleted := videoFile.BytesCompleted()
 			totalBytes := videoFile.Length()
 			progress := float64(bytesCompleted) / float64(totalBytes) * 100
-			stream.Progress = progress
+			stream.setProgress(progress)
 			
 			log.Printf("[%s] Progresso: %.1f%% (%.2f/%.2f MB)", 
 				stream.ID[:8], progress, 
@@ -450,7 +717,7 @@ func downloadAndTranscode(stream *StreamInfo) {
 				}
 			}
 			
-			if headersReady && (progress >= minPercent || bytesCompleted >= minBytes) && !transcodeStarted && stream.Status == "downloading" {
+			if headersReady && (progress >= minPercent || bytesCompleted >= minBytes) && !transcodeStarted && stream.State() == StateDownloading {
 				// Verificar se arquivo existe e se o FFmpeg consegue ler
 				// Usar limite mais baixo (8MB) para arquivos grandes já que os headers são pequenos
 				minFileSize := int64(10 * 1024 * 1024) // 10MB padrão
@@ -458,14 +725,17 @@ func downloadAndTranscode(stream *StreamInfo) {
 					minFileSize = 8 * 1024 * 1024 // 8MB para arquivos >10GB
 				}
 				
-				if info, err := os.Stat(stream.VideoFile); err == nil && info.Size() > minFileSize {
+				if info, err := os.Stat(videoPath); err == nil && info.Size() > minFileSize {
 					// Verificar se o FFmpeg consegue ler o arquivo
-					if canReadVideoFile(stream.VideoFile) {
+					if canReadVideoFile(videoPath) {
 						log.Printf("[%s] ⚡ Arquivo válido com %.2f MB, iniciando transcodificação rápida...", 
 							stream.ID[:8], float64(info.Size())/1024/1024)
 						transcodeStarted = true
-						stream.Status = "transcoding"
-						go transcodeToHLS(stream)
+						if err := stream.setState(StateTranscoding); err != nil {
+							log.Printf("[%s] ⚠️ %v", stream.ID[:8], err)
+							return
+						}
+						go transcodeToHLS(stream, done)
 					} else {
 						log.Printf("[%s] Aguardando mais dados... arquivo ainda não legível", stream.ID[:8])
 					}
@@ -481,7 +751,7 @@ func downloadAndTranscode(stream *StreamInfo) {
 	}
 }
 
-func monitorAndPrioritizePieces(stream *StreamInfo, videoFile *torrent.File) {
+func monitorAndPrioritizePieces(stream *StreamInfo, videoFile *torrent.File, done chan struct{}) {
 	t := stream.torrent
 	if t == nil { return }
 	
@@ -500,92 +770,159 @@ func monitorAndPrioritizePieces(stream *StreamInfo, videoFile *torrent.File) {
 	
 	for {
 		select {
-		case <-stream.cancelChan:
+		case <-done:
 			return
 		case <-ticker.C:
 			// Find first incomplete piece in the file range
 			startPriorityIndex := -1
 			
-			// Start scanning from the approximate current position to avoid scanning entire file
-			// But since pieces can be downloaded out of order, scanning from start of file is safer/more robust
-			// Optimization: keep track of last clean index?
-			// For now, linear scan of bitfield is fast enough for video files.
-			
-			for i := firstPieceIndex; i <= lastPieceIndex; i++ {
-				if i >= t.NumPieces() { break }
-				if !t.Piece(i).State().Complete {
-					startPriorityIndex = i
-					break
+			// After a seek, the window follows the playback position instead of the file start.
+			// If everything after that position is complete, fall back to a scan from the start.
+			scanFrom := firstPieceIndex
+			if offset := stream.readaheadOffset(); offset > 0 {
+				if p := int((fileOffset + offset) / pieceLength); p > scanFrom && p <= lastPieceIndex {
+					scanFrom = p
 				}
 			}
 			
+			startPriorityIndex = firstIncompletePiece(t, scanFrom, lastPieceIndex)
+			if startPriorityIndex == -1 && scanFrom != firstPieceIndex {
+				startPriorityIndex = firstIncompletePiece(t, firstPieceIndex, lastPieceIndex)
+			}
+			
 			if startPriorityIndex == -1 {
 				// All pieces complete
 				return
 			}
 			
-			// Prioritize next ~30MB (approx 15 seconds of 1080p)
-			windowBytes := int64(30 * 1024 * 1024)
-			piecesToPrioritize := int(windowBytes / pieceLength)
-			if piecesToPrioritize < 5 { piecesToPrioritize = 5 } // Minimum 5 pieces
-			
-			endPriorityIndex := startPriorityIndex + piecesToPrioritize
-			if endPriorityIndex > lastPieceIndex {
-				endPriorityIndex = lastPieceIndex
-			}
-			
-			// Apply priority
-			// Note: We don't clear priority of passed pieces because usually we want them to finish if they started.
-			for i := startPriorityIndex; i <= endPriorityIndex; i++ {
-				if i < t.NumPieces() {
-					t.Piece(i).SetPriority(torrent.PiecePriorityNow)
-				}
-			}
+			prioritizeWindow(t, startPriorityIndex, lastPieceIndex, pieceLength)
+		}
+	}
+}
+
+// firstIncompletePiece returns the first incomplete piece in [from, to], or -1.
+// A linear scan of the bitfield is fast enough for video files.
+func firstIncompletePiece(t *torrent.Torrent, from, to int) int {
+	for i := from; i <= to; i++ {
+		if i >= t.NumPieces() { break }
+		if !t.Piece(i).State().Complete {
+			return i
 		}
 	}
+	return -1
 }
 
-func transcodeToHLS(stream *StreamInfo) {
+// prioritizeWindow marks the next ~30MB (approx 15 seconds of 1080p) starting at startIndex as urgent
+func prioritizeWindow(t *torrent.Torrent, startIndex, lastPieceIndex int, pieceLength int64) {
+	windowBytes := int64(30 * 1024 * 1024)
+	piecesToPrioritize := int(windowBytes / pieceLength)
+	if piecesToPrioritize < 5 { piecesToPrioritize = 5 } // Minimum 5 pieces
+	
+	endPriorityIndex := startIndex + piecesToPrioritize
+	if endPriorityIndex > lastPieceIndex {
+		endPriorityIndex = lastPieceIndex
+	}
+	
+	// Apply priority
+	// Note: We don't clear priority of passed pieces because usually we want them to finish if they started.
+	for i := startIndex; i <= endPriorityIndex; i++ {
+		if i < t.NumPieces() {
+			t.Piece(i).SetPriority(torrent.PiecePriorityNow)
+		}
+	}
+}
+
+func transcodeToHLS(stream *StreamInfo, done chan struct{}) {
 	hlsDir := filepath.Join("./downloads", stream.ID, "hls")
 	if err := os.MkdirAll(hlsDir, 0755); err != nil {
-		stream.Status = "error"
-		stream.Error = fmt.Sprintf("Erro ao criar diretório HLS: %v", err)
+		stream.fail("Erro ao criar diretório HLS: %v", err)
 		return
 	}
 
-	stream.HLSPath = hlsDir
+	stream.setHLSPath(hlsDir)
+	videoPath := stream.currentMedia().VideoFile
 
 	// Aguardar arquivo existir - timeout mais curto para início rápido
 	for i := 0; i < 30; i++ {
-		if info, err := os.Stat(stream.VideoFile); err == nil && info.Size() > 5*1024*1024 {
+		if info, err := os.Stat(videoPath); err == nil && info.Size() > 5*1024*1024 {
 			break
 		}
 		time.Sleep(500 * time.Millisecond)
 	}
 
+	// O arquivo pode ter sido trocado enquanto aguardávamos
+	select {
+	case <-done:
+		return
+	default:
+	}
+
 	// Detectar resolução do vídeo fonte
-	sourceWidth, sourceHeight := getVideoResolution(stream.VideoFile)
-	stream.SourceWidth = sourceWidth
-	stream.SourceHeight = sourceHeight
+	sourceWidth, sourceHeight := getVideoResolution(videoPath)
 	log.Printf("[%s] Resolução fonte: %dx%d", stream.ID[:8], sourceWidth, sourceHeight)
 
+	// Frame rate define o GOP: os keyframes precisam cair nas fronteiras dos segmentos
+	frameRate := getVideoFrameRate(videoPath)
+	log.Printf("[%s] Frame rate fonte: %.3f fps", stream.ID[:8], frameRate)
+
+	// Proporção do pixel (anamórfico) e entrelaçamento definem escala e deinterlace
+	geometry := getVideoGeometry(videoPath)
+	log.Printf("[%s] Geometria fonte: %s", stream.ID[:8], geometry)
+
 	// Detectar faixas de áudio disponíveis
-	audioTracks := GetAudioTracksInfo(stream.VideoFile)
-	stream.AudioTracks = audioTracks
+	audioTracks := GetAudioTracksInfo(videoPath)
 	log.Printf("[%s] Faixas de áudio detectadas: %d", stream.ID[:8], len(audioTracks))
 
-	// Determinar quais qualidades gerar baseado na resolução fonte
-	availableQualities := []QualityLevel{}
-	for _, q := range qualityLevels {
-		if q.Height <= sourceHeight {
-			availableQualities = append(availableQualities, q)
+	// Detectar legendas em texto (convertidas para WebVTT)
+	// e legendas externas (.srt/.ass) que acompanham o vídeo no torrent
+	subtitleTracks := GetSubtitleTracksInfo(videoPath)
+	subtitleTracks = append(subtitleTracks, sidecarSubtitleTracks(stream, len(subtitleTracks))...)
+
+	// Informações gerais do vídeo (duração é usada para mapear segmento -> posição no arquivo)
+	duration, videoCodec, audioCodec, audioCount, subtitleCount, color := GetVideoInfo(videoPath)
+	if color.IsHDR() {
+		log.Printf("[%s] 🌈 Fonte HDR (%s, %s/%s): qualidades reencodadas passam por tone mapping para SDR",
+			stream.ID[:8], color.HDRFormat, color.Transfer, color.Primaries)
+		if color.DVProfile == 5 {
+			// Perfil 5 não tem camada base HDR10: sem processar o RPU as cores saem erradas
+			log.Printf("[%s] ⚠️ Dolby Vision perfil 5: cores podem ficar incorretas após o tone mapping", stream.ID[:8])
 		}
 	}
-	
-	if len(availableQualities) == 0 {
-		availableQualities = []QualityLevel{qualityLevels[0]}
+
+	stream.updateMedia(func(m *mediaInfo) {
+		m.SourceWidth = sourceWidth
+		m.SourceHeight = sourceHeight
+		m.AudioTracks = audioTracks
+		m.SubtitleTracks = subtitleTracks
+		m.Duration = duration
+		m.FrameRate = frameRate
+		m.Color = color
+		m.Geometry = geometry
+	})
+
+	// Determinar quais qualidades gerar baseado na resolução fonte e nos limites pedidos.
+	// A configuração é fixada aqui: uma recarga só vale para o próximo arquivo.
+	cfg := currentEncodingConfig()
+	availableQualities := fitToSource(cfg.ladderFor(sourceHeight, stream.minQuality, stream.maxQuality), stream.currentMedia())
+
+	// Fonte já compatível com o navegador: variante extra sem reencodar (qualidade idêntica à fonte),
+	// desde que não ultrapasse o maxQuality pedido
+	_, maxHeight := cfg.heightLimits("", stream.maxQuality)
+	if maxHeight == 0 || sourceHeight <= maxHeight {
+		if original, ok := remuxVariant(stream, videoCodec); ok {
+			availableQualities = append(availableQualities, original)
+		}
 	}
 
+	// Áudio transcodificado uma vez por faixa, em playlists próprias (as qualidades saem só com vídeo)
+	audioRenditions := append(stereoRenditions(cfg, audioTracks), surroundRenditions(cfg, audioTracks)...)
+
+	stream.mu.Lock()
+	stream.ladder = availableQualities
+	stream.audioRenditions = audioRenditions
+	stream.encoding = cfg
+	stream.mu.Unlock()
+
 	log.Printf("[%s] Gerando %d qualidades: %v", stream.ID[:8], len(availableQualities), 
 		func() []string {
 			names := make([]string, len(availableQualities))
@@ -595,6 +932,15 @@ func transcodeToHLS(stream *StreamInfo) {
 			return names
 		}())
 
+	// Playlists VOD completas (duração total e ENDLIST) antes do primeiro segmento:
+	// o player mostra a duração real e pode buscar além do que já foi codificado
+	if err := writeVODPlaylists(stream, availableQualities, audioRenditions); err != nil {
+		log.Printf("[%s] ⚠️ Erro ao gerar playlists VOD: %v", stream.ID[:8], err)
+	}
+
+	// Miniaturas: trilha e playlist de imagens já entram no master; as folhas vêm com o download
+	thumbnails := prepareThumbnails(stream)
+
 	// OTIMIZAÇÃO CRÍTICA: Gerar Master Playlist IMEDIATAMENTE.
 	// Assumimos que todas as qualidades serão geradas.
 	// Isso permite que o player saiba o que esperar e tente carregar assim que possível.
@@ -602,17 +948,53 @@ func transcodeToHLS(stream *StreamInfo) {
 		log.Printf("[%s] Erro ao gerar master playlist: %v", stream.ID[:8], err)
 	}
 
+	onDemand := stream.onDemand()
+	if transcodeMode == TranscodeOnDemand && !onDemand {
+		log.Printf("[%s] ⚠️ Duração desconhecida: todas as renditions serão transcodificadas desde o início", stream.ID[:8])
+	}
+	startQualities, startAudio := initialRenditions(availableQualities, audioRenditions, onDemand)
+	if onDemand {
+		go reapIdleWorkers(stream, done)
+	}
+	// FFmpeg que termina antes do fim ou trava é retomado do último segmento (ver supervisor.go)
+	go superviseStalls(stream, done)
+
+	// Legendas e faixas de áudio são geradas em paralelo ao vídeo
+	extractSubtitles(stream, subtitleTracks, done)
+	for _, r := range startAudio {
+		if err := transcodeAudio(stream, r, seekPoint{}); err != nil {
+			log.Printf("[%s] ⚠️ %s: %v", stream.ID[:8], r.Name, err)
+		}
+	}
+	if thumbnails != nil {
+		go generateThumbnails(stream, *thumbnails, done)
+	}
+
 	// Canais para monitorar início
-	qualitiesReady := make(chan string, len(availableQualities))
-	errors := make(chan error, len(availableQualities))
+	qualitiesReady := make(chan string, len(startQualities))
+	errors := make(chan error, len(startQualities))
 	
 	// A qualidade mais baixa (primeira da lista) é a crítica para desbloquear o player
 	lowestQualityName := availableQualities[0].Name
 
+	// Pipeline "single": um único FFmpeg decodifica a fonte uma vez e gera todas as qualidades
+	// reencodadas (a variante sem reencode segue em processo próprio)
+	if transcodePipeline == PipelineSingle {
+		if err := transcodeLadder(stream, encodedRungs(availableQualities), seekPoint{}); err != nil {
+			stream.fail("Erro ao iniciar FFmpeg: %v", err)
+			return
+		}
+	}
+
 	// Iniciar transcodificação de TODAS as qualidades em background
-	for _, q := range availableQualities {
+	for _, q := range startQualities {
 		go func(quality QualityLevel) {
-			err := transcodeQuality(stream, quality)
+			var err error
+			if transcodePipeline == PipelineSingle && !quality.Copy {
+				err = waitLadderQuality(stream, quality, done)
+			} else {
+				err = transcodeQuality(stream, quality, done)
+			}
 			if err != nil {
 				errors <- fmt.Errorf("%s: %v", quality.Name, err)
 			} else {
@@ -630,7 +1012,7 @@ func transcodeToHLS(stream *StreamInfo) {
 	go func() {
 		// Monitorar progresso geral e erros
 		readyCount := 0
-		totalQualities := len(availableQualities)
+		totalQualities := len(startQualities)
 		
 		for readyCount < totalQualities {
 			select {
@@ -640,15 +1022,17 @@ func transcodeToHLS(stream *StreamInfo) {
 				// Se a qualidade pronta for a mais baixa (ou se for a primeira a ficar pronta), liberar o player!
 				if !streamReady && (qName == lowestQualityName || readyCount == 1) {
 					streamReady = true
-					stream.Status = "ready"
-					stream.Qualities = []string{qName} // Inicialmente só sabemos dessa
-					stream.HLSPath = hlsDir // Garantir caminho
+					// Inicialmente só sabemos dessa qualidade.
+					// Um stream que já falhou não volta a ficar pronto.
+					if err := stream.markReady(qName); err != nil {
+						log.Printf("[%s] ⚠️ %v", stream.ID[:8], err)
+						continue
+					}
 					
 					log.Printf("[%s] 🎬 STREAM PRONTO! Qualidade %s iniciou. Liberando player.", stream.ID[:8], qName)
 					
 					// Salvar metadados no cache
-					duration, videoCodec, audioCodec, audioTracks, subtitleTracks := GetVideoInfo(stream.VideoFile)
-					GetMetadataCache().UpdateFromStream(stream, duration, videoCodec, audioCodec, audioTracks, subtitleTracks)
+					GetMetadataCache().UpdateFromStream(stream, duration, videoCodec, audioCodec, audioCount, subtitleCount)
 				} else {
 					log.Printf("[%s] Qualidade adicional pronta: %s", stream.ID[:8], qName)
 				}
@@ -657,7 +1041,7 @@ func transcodeToHLS(stream *StreamInfo) {
 				log.Printf("[%s] ⚠️ Erro em transcodificação: %v", stream.ID[:8], err)
 				readyCount++ // Contar como "finalizado" (com erro) para não bloquear loop se fosse o caso
 				
-			case <-stream.cancelChan:
+			case <-done:
 				return
 			}
 		}
@@ -666,40 +1050,48 @@ func transcodeToHLS(stream *StreamInfo) {
 }
 
 // transcodeQuality transcodifica para uma qualidade específica
-func transcodeQuality(stream *StreamInfo, quality QualityLevel) error {
-	qualityDir := filepath.Join(stream.HLSPath, quality.Name)
+func transcodeQuality(stream *StreamInfo, quality QualityLevel, done chan struct{}) error {
+	qualityDir := filepath.Join(stream.hlsDir(), quality.Name)
 	if err := os.MkdirAll(qualityDir, 0755); err != nil {
 		return err
 	}
 
-	playlistPath := filepath.Join(qualityDir, "playlist.m3u8")
-	segmentPath := filepath.Join(qualityDir, "segment%03d.ts")
+	playlistPath := filepath.Join(qualityDir, encoderPlaylistName)
+	segmentPath := segmentPattern(qualityDir)
 
 	log.Printf("[%s] Iniciando transcodificação %s (%dx%d @ %s)...", 
 		stream.ID[:8], quality.Name, quality.Width, quality.Height, quality.Bitrate)
 
 	// Construir argumentos FFmpeg baseado no hardware disponível e faixas de áudio
-	args := buildFFmpegArgs(stream.VideoFile, quality, playlistPath, segmentPath, stream.AudioTracks)
+	media := stream.currentMedia()
+	args := buildFFmpegArgs(stream.encodingConfig(), media, quality, playlistPath, segmentPath, seekPoint{})
 
-	cmd := exec.Command("ffmpeg", args...)
-	
-	// Log de erros do FFmpeg
-	cmd.Stderr = os.Stderr
-
-	// Adicionar à lista de processos do stream
-	mu.Lock()
-	stream.ffmpegProcs = append(stream.ffmpegProcs, cmd)
-	mu.Unlock()
-
-	if err := cmd.Start(); err != nil {
+	// O progresso do job (tempo codificado, velocidade, segmentos) é acompanhado pela saída -progress
+	job, err := runQualityJob(stream, quality, args, 0)
+	if err != nil {
 		return fmt.Errorf("erro ao iniciar FFmpeg: %v", err)
 	}
 
+	if err := waitFirstSegment(stream, quality, qualityDir, done); err != nil {
+		if err == errSegmentTimeout {
+			stream.failJob(job, err.Error())
+		}
+		stream.killQualityCmd(quality.Name)
+		return err
+	}
+	return nil
+}
+
+var errSegmentTimeout = fmt.Errorf("timeout aguardando segmentos")
+
+// waitFirstSegment aguarda a qualidade gerar o primeiro segmento.
+// O FFmpeg continua rodando em background depois disso.
+// O tempo na fila do scheduler (ou pausado por ele) não conta para o timeout.
+func waitFirstSegment(stream *StreamInfo, quality QualityLevel, qualityDir string, done chan struct{}) error {
 	// Aguardar pelo menos 1 segmento ser criado (mais rápido)
-	for i := 0; i < 45; i++ {
+	for waited := 0; waited < 45; {
 		select {
-		case <-stream.cancelChan:
-			cmd.Process.Kill()
+		case <-done:
 			return fmt.Errorf("cancelado")
 		default:
 		}
@@ -707,32 +1099,61 @@ func transcodeQuality(stream *StreamInfo, quality QualityLevel) error {
 		// 1 segmento já é suficiente para começar a reproduzir
 		if countSegmentsInDir(qualityDir) >= 1 {
 			log.Printf("[%s] %s: primeiro segmento pronto!", stream.ID[:8], quality.Name)
-			
-			// Continuar rodando em background
-			go func() {
-				cmd.Wait()
-				log.Printf("[%s] %s: transcodificação completa", stream.ID[:8], quality.Name)
-			}()
-			
 			return nil
 		}
 		time.Sleep(time.Second)
+		if !stream.jobWaiting(quality.Name) {
+			waited++
+		}
 	}
 
-	cmd.Process.Kill()
-	return fmt.Errorf("timeout aguardando segmentos")
+	return errSegmentTimeout
 }
 
 // buildFFmpegArgs constrói os argumentos do FFmpeg baseado no hardware disponível
-func buildFFmpegArgs(inputFile string, quality QualityLevel, playlistPath, segmentPath string, audioTracks []AudioTrackInfo) []string {
+// Com seek.Time > 0, a entrada começa nessa posição; num reinício (seek.Restart) a numeração dos segmentos continua em seek.Segment.
+func buildFFmpegArgs(cfg *EncodingConfig, media mediaInfo, quality QualityLevel, playlistPath, segmentPath string, seek seekPoint) []string {
 	// Garantir que hwAccel foi detectado
 	hwAccelInit.Do(func() {
 		hwAccel = detectHardwareAcceleration()
 	})
 	
+	// Adicionar hardware acceleration de entrada se disponível (remux não decodifica)
+	decoder := hwAccel
+	if quality.Copy {
+		decoder = ""
+	}
+	args := ffmpegInputArgs(media.VideoFile, decoder, seek)
+
+	// Só o vídeo: as faixas de áudio têm playlists próprias (ver audio.go)
+	args = append(args, "-map", "0:v:0", "-an", "-sn")
+	
+	// Adicionar filtros e codecs baseado no hardware
+	encoder := hwAccel
+	if quality.Copy {
+		encoder = "copy"
+	}
+	if filter := videoFilter(encoder, quality, media); filter != "" {
+		args = append(args, "-vf", filter)
+	}
+	args = append(args, videoCodecArgs(cfg, encoder, quality, media.FrameRate, "v")...)
+	
+	args = append(args, hlsOutputArgs(cfg, seek, "init.mp4")...)
+	args = append(args,
+		"-hls_segment_filename", segmentPath,
+		"-f", "hls",
+		playlistPath,
+	)
+	
+	return args
+}
+
+// ffmpegInputArgs retorna os argumentos de entrada comuns a todos os jobs de vídeo
+func ffmpegInputArgs(inputFile, decoder string, seek seekPoint) []string {
 	// Args base de entrada - otimizado para arquivos parcialmente baixados
 	args := []string{
 		"-y",
+		"-progress", "pipe:1", // Progresso em chave=valor no stdout (lido por watchProgress)
 		"-fflags", "+genpts+igndts+discardcorrupt+nobuffer",
 		"-flags", "low_delay",
 		"-strict", "experimental",
@@ -743,8 +1164,7 @@ func buildFFmpegArgs(inputFile string, quality QualityLevel, playlistPath, segme
 		"-thread_queue_size", "512",
 	}
 	
-	// Adicionar hardware acceleration de entrada se disponível
-	switch hwAccel {
+	switch decoder {
 	case "vaapi":
 		args = append(args, "-hwaccel", "vaapi", "-hwaccel_device", "/dev/dri/renderD128", "-hwaccel_output_format", "vaapi")
 	case "nvenc":
@@ -753,118 +1173,196 @@ func buildFFmpegArgs(inputFile string, quality QualityLevel, playlistPath, segme
 		args = append(args, "-hwaccel", "qsv")
 	}
 	
-	args = append(args, "-i", inputFile)
-
-	// Mapear o stream de vídeo
-	args = append(args, "-map", "0:v:0")
+	// Seek na entrada (rápido, por keyframe) quando o job é reiniciado em outra posição
+	if seek.Time > 0 {
+		args = append(args, "-ss", fmt.Sprintf("%.3f", seek.Time))
+	}
+	
+	return append(args, "-i", inputFile)
+}
 
-	// Mapear TODAS as faixas de áudio
-	if len(audioTracks) > 1 {
-		// Se há múltiplas faixas, mapear cada uma explicitamente
-		for i := range audioTracks {
-			args = append(args, "-map", fmt.Sprintf("0:a:%d", i))
+// videoFilter retorna a cadeia de vídeo completa da qualidade para o encoder ("" no remux)
+func videoFilter(encoder string, quality QualityLevel, media mediaInfo) string {
+	var filters []string
+	for _, f := range []string{sourceFilter(encoder, media), qualityFilter(encoder, quality, media)} {
+		if f != "" {
+			filters = append(filters, f)
 		}
-		log.Printf("[FFmpeg] Mapeando %d faixas de áudio", len(audioTracks))
-	} else {
-		// Apenas uma faixa ou nenhuma detectada - mapear todas as faixas de áudio disponíveis
-		args = append(args, "-map", "0:a?")
 	}
-	
-	// Adicionar filtros e codecs baseado no hardware
-	switch hwAccel {
+	return strings.Join(filters, ",")
+}
+
+// qualityFilter retorna a escala da qualidade (dimensões já ajustadas por fitToSource).
+// setsar=1 marca os pixels como quadrados: a proporção da fonte anamórfica já está nas dimensões.
+// Fontes HDR recebem o tone mapping para SDR logo após a escala.
+func qualityFilter(encoder string, quality QualityLevel, media mediaInfo) string {
+	toneMap := toneMapFilter(encoder, media.Color)
+
+	var scale string
+	switch {
+	case encoder == "copy":
+		return ""
+	case encoder == "vaapi":
+		scale = fmt.Sprintf("format=nv12|vaapi,hwupload,scale_vaapi=%d:%d", quality.Width, quality.Height)
+	case encoder == "nvenc", encoder == "qsv":
+		scale = fmt.Sprintf("scale=%d:%d", quality.Width, quality.Height)
+	default:
+		scale = fmt.Sprintf("scale=%d:%d:flags=bilinear", quality.Width, quality.Height)
+	}
+	scale += ",setsar=1"
+
+	if toneMap == "" {
+		return scale
+	}
+	return scale + "," + toneMap
+}
+
+// videoCodecArgs retorna codec e controle de taxa da qualidade.
+// spec é o especificador do stream de saída ("v", ou "v:N" quando um processo gera várias qualidades).
+// frameRate é o da fonte (0 = desconhecido), usado para alinhar os keyframes aos segmentos.
+func videoCodecArgs(cfg *EncodingConfig, encoder string, quality QualityLevel, frameRate float64, spec string) []string {
+	opt := func(name string) string {
+		return "-" + name + ":" + spec
+	}
+
+	// Perfil e nível anunciados no CODECS (ver videoCodecs)
+	level := encodedLevel(quality, frameRate)
+
+	var args []string
+	switch encoder {
+	case "copy":
+		// Remux: vídeo copiado da fonte, segmentos cortados nos keyframes originais
+		args = append(args, opt("c"), "copy")
+		log.Printf("[Remux] Copiando vídeo da fonte para %s", quality.Name)
+		
 	case "vaapi":
 		// VAAPI encoding
 		args = append(args,
-			"-vf", fmt.Sprintf("format=nv12|vaapi,hwupload,scale_vaapi=%d:%d", quality.Width, quality.Height),
-			"-c:v", "h264_vaapi",
-			"-qp", fmt.Sprintf("%d", quality.CRF+5), // VAAPI usa QP ao invés de CRF
-			"-maxrate", quality.MaxBitrate,
-			"-bufsize", quality.BufSize,
+			opt("c"), "h264_vaapi",
+			opt("qp"), fmt.Sprintf("%d", quality.CRF+5), // VAAPI usa QP ao invés de CRF
+			opt("maxrate"), quality.MaxBitrate,
+			opt("bufsize"), quality.BufSize,
+			opt("profile"), encodedH264Profile,
+			opt("level"), levelName(level),
 		)
 		log.Printf("[VAAPI] Usando hardware encoding para %s", quality.Name)
 		
 	case "nvenc":
 		// NVIDIA NVENC encoding
 		args = append(args,
-			"-vf", fmt.Sprintf("scale=%d:%d", quality.Width, quality.Height),
-			"-c:v", "h264_nvenc",
-			"-preset", "p4", // NVENC preset (p1=fastest, p7=slowest)
-			"-rc", "vbr",
-			"-cq", fmt.Sprintf("%d", quality.CRF),
-			"-maxrate", quality.MaxBitrate,
-			"-bufsize", quality.BufSize,
+			opt("c"), "h264_nvenc",
+			opt("preset"), "p4", // NVENC preset (p1=fastest, p7=slowest)
+			opt("rc"), "vbr",
+			opt("cq"), fmt.Sprintf("%d", quality.CRF),
+			opt("maxrate"), quality.MaxBitrate,
+			opt("bufsize"), quality.BufSize,
+			opt("forced-idr"), "1", // Keyframes forçados viram IDR (início de segmento decodificável)
+			opt("profile"), encodedH264Profile,
+			opt("level"), levelName(level),
 		)
 		log.Printf("[NVENC] Usando hardware encoding para %s", quality.Name)
 		
 	case "qsv":
 		// Intel Quick Sync encoding
 		args = append(args,
-			"-vf", fmt.Sprintf("scale=%d:%d", quality.Width, quality.Height),
-			"-c:v", "h264_qsv",
-			"-preset", "faster",
-			"-global_quality", fmt.Sprintf("%d", quality.CRF),
-			"-maxrate", quality.MaxBitrate,
-			"-bufsize", quality.BufSize,
+			opt("c"), "h264_qsv",
+			opt("preset"), "faster",
+			opt("global_quality"), fmt.Sprintf("%d", quality.CRF),
+			opt("maxrate"), quality.MaxBitrate,
+			opt("bufsize"), quality.BufSize,
+			opt("profile"), encodedH264Profile,
+			opt("level"), fmt.Sprintf("%d", level), // QSV só aceita o level_idc numérico
 		)
 		log.Printf("[QSV] Usando hardware encoding para %s", quality.Name)
 		
 	default:
 		// Software encoding (libx264)
 		args = append(args,
-			"-vf", fmt.Sprintf("scale=%d:%d:flags=bilinear", quality.Width, quality.Height),
-			"-c:v", "libx264",
-			"-preset", quality.Preset,
-			"-tune", "zerolatency",
-			"-crf", fmt.Sprintf("%d", quality.CRF),
-			"-maxrate", quality.MaxBitrate,
-			"-bufsize", quality.BufSize,
-			"-profile:v", "main",
-			"-level", "4.0",
+			opt("c"), "libx264",
+			opt("preset"), quality.Preset,
+			opt("tune"), "zerolatency",
+			opt("crf"), fmt.Sprintf("%d", quality.CRF),
+			opt("maxrate"), quality.MaxBitrate,
+			opt("bufsize"), quality.BufSize,
+			opt("profile"), encodedH264Profile,
+			opt("level"), levelName(level),
 		)
 	}
 	
-	// Args comuns para keyframes
-	args = append(args,
-		"-g", "48",
-		"-keyint_min", "48",
-		"-sc_threshold", "0",
-	)
+	// Args comuns para keyframes (no remux os keyframes são os da fonte).
+	// Keyframes forçados nos múltiplos exatos da duração do segmento: todas as qualidades
+	// cortam os segmentos nos mesmos instantes, qualquer que seja o frame rate da fonte.
+	if !quality.Copy {
+		gop := cfg.gopFor(frameRate)
+		args = append(args,
+			opt("g"), fmt.Sprintf("%d", gop),
+			opt("keyint_min"), fmt.Sprintf("%d", gop),
+			opt("sc_threshold"), "0",
+			opt("force_key_frames"), fmt.Sprintf("expr:gte(t,n_forced*%d)", cfg.SegmentDuration),
+		)
+	}
 	
-	// Codec de áudio AAC para TODAS as faixas
-	args = append(args,
-		"-c:a", "aac",
-		"-b:a", quality.AudioRate,
-		"-ac", "2",
-		"-ar", "48000",
-	)
+	return args
+}
 
-	// Adicionar metadados de idioma para cada faixa de áudio
-	for i, track := range audioTracks {
-		args = append(args, fmt.Sprintf("-metadata:s:a:%d", i), fmt.Sprintf("language=%s", track.Language))
-		if track.Title != "" {
-			args = append(args, fmt.Sprintf("-metadata:s:a:%d", i), fmt.Sprintf("title=%s", track.Title))
-		}
+// hlsOutputArgs retorna as opções do muxer HLS comuns a todos os jobs de vídeo.
+// initName é o segmento de inicialização do fMP4 (ignorado em MPEG-TS).
+func hlsOutputArgs(cfg *EncodingConfig, seek seekPoint, initName string) []string {
+	var args []string
+
+	// temp_file faz o muxer escrever segmentos/playlist em arquivo temporário e renomear ao final.
+	// Isso evita que o player leia segmentos .ts parcialmente gravados (causando erro 3018 no Shaka).
+	hlsFlags := "independent_segments+append_list+temp_file"
+	if seek.Restart {
+		// Manter timestamps absolutos e nomes de segmento alinhados com a posição no vídeo.
+		// append_list não é usado aqui porque renumeraria os segmentos a partir da playlist antiga
+		// (inclusive num reinício no segmento 0).
+		args = append(args,
+			"-output_ts_offset", fmt.Sprintf("%.3f", seek.Time),
+			"-start_number", fmt.Sprintf("%d", seek.Segment),
+		)
+		hlsFlags = "independent_segments+temp_file"
+	}
+	
+	// fMP4: o muxer grava o init ao lado da playlist e o referencia com #EXT-X-MAP
+	if segmentFormat == SegmentFormatFMP4 {
+		args = append(args, "-hls_fmp4_init_filename", initName)
 	}
 	
 	// Configurações HLS
-	args = append(args,
-		"-hls_time", "2",
+	return append(args,
+		"-hls_time", fmt.Sprintf("%d", cfg.SegmentDuration),
 		"-hls_list_size", "0",
-		// temp_file faz o muxer escrever segmentos/playlist em arquivo temporário e renomear ao final.
-		// Isso evita que o player leia segmentos .ts parcialmente gravados (causando erro 3018 no Shaka).
-		"-hls_flags", "independent_segments+append_list+temp_file",
-		"-hls_segment_type", "mpegts",
-		"-hls_segment_filename", segmentPath,
-		"-f", "hls",
-		playlistPath,
+		"-hls_flags", hlsFlags,
+		"-hls_segment_type", segmentFormat,
 	)
-	
-	return args
+}
+
+// FilterMasterPlaylist deixa no master playlist só as variantes das qualidades dadas
+// (faixas de áudio, legendas e miniaturas são mantidas)
+func FilterMasterPlaylist(data []byte, ladder []QualityLevel) []byte {
+	allowed := make(map[string]bool, len(ladder))
+	for _, q := range ladder {
+		allowed[q.Name+"/playlist.m3u8"] = true
+	}
+
+	lines := strings.Split(string(data), "\n")
+	kept := make([]string, 0, len(lines))
+	for i := 0; i < len(lines); i++ {
+		// #EXT-X-STREAM-INF vem seguido da URI da variante
+		if strings.HasPrefix(lines[i], "#EXT-X-STREAM-INF:") && i+1 < len(lines) && !allowed[lines[i+1]] {
+			i++
+			continue
+		}
+		kept = append(kept, lines[i])
+	}
+	return []byte(strings.Join(kept, "\n"))
 }
 
 // generateMasterPlaylist gera o master playlist HLS com todas as qualidades e faixas de áudio
 func generateMasterPlaylist(stream *StreamInfo, qualities []QualityLevel) error {
-	masterPath := filepath.Join(stream.HLSPath, "master.m3u8")
+	media := stream.currentMedia()
+	masterPath := filepath.Join(stream.hlsDir(), "master.m3u8")
 
 	// Gerar master playlist contendo todas as qualidades previstas
 	// Não verificamos existência dos arquivos porque eles serão gerados em breve
@@ -879,59 +1377,93 @@ func generateMasterPlaylist(stream *StreamInfo, qualities []QualityLevel) error
 	f.WriteString("#EXTM3U\n")
 	f.WriteString("#EXT-X-VERSION:4\n") // Versão 4 para suportar EXT-X-MEDIA
 
-	// Se há múltiplas faixas de áudio, declará-las com EXT-X-MEDIA
-	audioGroup := ""
-	if len(stream.AudioTracks) > 1 {
-		audioGroup = "audio"
-		for i, track := range stream.AudioTracks {
+	// Faixas de áudio: playlists próprias referenciadas por URI (as variantes de vídeo não têm áudio).
+	// Estéreo no grupo "audio"; multicanal, quando configurado, no grupo "surround".
+	renditions := stream.currentAudioRenditions()
+	groupBandwidth := make(map[string]int)
+	groupCodecs := make(map[string][]string)
+	groupDefault := make(map[string]bool)
+	for _, r := range renditions {
+		// Uma faixa padrão por grupo (a primeira: as faixas seguem a ordem da fonte)
+		isDefault := "NO"
+		if !groupDefault[r.Group] {
+			isDefault = "YES"
+			groupDefault[r.Group] = true
+		}
+
+		f.WriteString(fmt.Sprintf("#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"%s\",NAME=\"%s\",LANGUAGE=\"%s\",DEFAULT=%s,AUTOSELECT=YES,CHANNELS=\"%d\",URI=\"%s/playlist.m3u8\"\n",
+			r.Group, hlsQuoted(r.displayName()), hlsQuoted(r.Track.Language), isDefault, r.Channels, r.Name))
+
+		if bw := parseKbps(r.Bitrate) * 1000; bw > groupBandwidth[r.Group] {
+			groupBandwidth[r.Group] = bw
+		}
+		if !containsString(groupCodecs[r.Group], r.hlsCodec()) {
+			groupCodecs[r.Group] = append(groupCodecs[r.Group], r.hlsCodec())
+		}
+	}
+	if len(renditions) > 0 {
+		f.WriteString("\n")
+		log.Printf("[%s] 🔊 Master playlist incluiu %d faixas de áudio", stream.ID[:8], len(renditions))
+	}
+
+	// Legendas WebVTT como renditions de legenda
+	subtitleGroup := ""
+	if len(media.SubtitleTracks) > 0 {
+		subtitleGroup = "subs"
+		for _, track := range media.SubtitleTracks {
 			isDefault := "NO"
-			if track.Default || i == 0 {
+			if track.Default {
 				isDefault = "YES"
 			}
-			
-			// Nome amigável para a faixa
-			name := track.Title
-			if name == "" {
-				name = getLanguageName(track.Language)
+			forced := "NO"
+			if track.Forced {
+				forced = "YES"
 			}
 			
-			// Canais formatados
-			channels := ""
-			if track.Channels > 0 {
-				if track.Channels >= 6 {
-					channels = fmt.Sprintf(",CHANNELS=\"%d\"", track.Channels)
-				} else {
-					channels = fmt.Sprintf(",CHANNELS=\"%d\"", track.Channels)
-				}
-			}
-			
-			// EXT-X-MEDIA para áudio alternativo
-			// Note: Não usamos URI aqui porque o áudio está multiplexado nos segmentos .ts
-			// O Shaka Player identificará as faixas pelos metadados dos segmentos
-			f.WriteString(fmt.Sprintf("#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"%s\",NAME=\"%s\",LANGUAGE=\"%s\",DEFAULT=%s,AUTOSELECT=%s%s\n",
-				audioGroup, name, track.Language, isDefault, isDefault, channels))
+			f.WriteString(fmt.Sprintf("#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID=\"%s\",NAME=\"%s\",LANGUAGE=\"%s\",DEFAULT=%s,AUTOSELECT=YES,FORCED=%s,URI=\"%s/playlist.m3u8\"\n",
+				subtitleGroup, hlsQuoted(track.Title), hlsQuoted(track.Language), isDefault, forced, track.Rendition))
 		}
 		f.WriteString("\n")
-		log.Printf("[%s] 🔊 Master playlist incluiu %d faixas de áudio", stream.ID[:8], len(stream.AudioTracks))
+		log.Printf("[%s] 💬 Master playlist incluiu %d legendas", stream.ID[:8], len(media.SubtitleTracks))
 	}
 
-	// Escrever cada qualidade (ordenar por bandwidth crescente para o player)
-	for _, q := range qualities {
-		// Converter bitrate string para int
-		bitrateStr := strings.TrimSuffix(q.Bitrate, "k")
-		var bitrate int
-		fmt.Sscanf(bitrateStr, "%d", &bitrate)
-		bitrate *= 1000
-		
-		// Incluir referência ao grupo de áudio se houver múltiplas faixas
-		if audioGroup != "" {
-			f.WriteString(fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,NAME=\"%s\",AUDIO=\"%s\"\n", 
-				bitrate, q.Width, q.Height, q.Name, audioGroup))
-		} else {
-			f.WriteString(fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,NAME=\"%s\"\n", 
-				bitrate, q.Width, q.Height, q.Name))
+	// Cada qualidade é anunciada uma vez por grupo de áudio (só vídeo, sem áudio, se não houver faixas).
+	// CODECS deixa clientes sem o decoder (ex: navegadores sem AC-3) fora das variantes surround.
+	audioGroups := []string{""}
+	if len(renditions) > 0 {
+		audioGroups = nil
+		for _, group := range []string{stereoGroup, surroundGroup} {
+			if len(groupCodecs[group]) > 0 {
+				audioGroups = append(audioGroups, group)
+			}
+		}
+	}
+	for _, group := range audioGroups {
+		for _, q := range qualities {
+			codecs := append([]string{videoCodecs(q, media.FrameRate)}, groupCodecs[group]...)
+
+			name := q.Name
+			attrs := ""
+			if group != "" {
+				attrs += fmt.Sprintf(",AUDIO=\"%s\"", group)
+				if group != stereoGroup {
+					name += " " + group
+				}
+			}
+			if subtitleGroup != "" {
+				attrs += fmt.Sprintf(",SUBTITLES=\"%s\"", subtitleGroup)
+			}
+			attrs += variantRange(media, q)
+
+			f.WriteString(fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,CODECS=\"%s\",NAME=\"%s\"%s\n",
+				parseKbps(q.Bitrate)*1000+groupBandwidth[group], q.Width, q.Height, strings.Join(codecs, ","), name, attrs))
+			f.WriteString(fmt.Sprintf("%s/playlist.m3u8\n", q.Name))
 		}
-		f.WriteString(fmt.Sprintf("%s/playlist.m3u8\n", q.Name))
+	}
+
+	// Miniaturas do seek bar (playlist de imagens com #EXT-X-TILES)
+	if thumbnails := stream.currentThumbnails(); thumbnails != nil {
+		f.WriteString("\n" + thumbnails.imageStreamInf())
 	}
 
 	log.Printf("[%s] 📋 Master playlist gerado antecipadamente com %d qualidades", 
@@ -940,6 +1472,31 @@ func generateMasterPlaylist(stream *StreamInfo, qualities []QualityLevel) error
 	return nil
 }
 
+// variantRange retorna o atributo VIDEO-RANGE da variante ("" em fonte SDR).
+// Em fonte HDR só a variante sem reencode mantém o HDR; as demais saem do tone mapping.
+func variantRange(media mediaInfo, q QualityLevel) string {
+	if !media.Color.IsHDR() {
+		return ""
+	}
+	if q.Copy {
+		return ",VIDEO-RANGE=" + media.Color.videoRange()
+	}
+	return ",VIDEO-RANGE=SDR"
+}
+
+// hlsQuoted remove de um texto da fonte (título de faixa, nome de arquivo) o que não pode
+// aparecer em um atributo entre aspas do HLS: aspas duplas e quebras de linha
+func hlsQuoted(s string) string {
+	return strings.NewReplacer("\"", "'", "\r", " ", "\n", " ").Replace(s)
+}
+
+// parseKbps converte um bitrate como "1400k" em kbps (0 se inválido)
+func parseKbps(bitrate string) int {
+	var kbps int
+	fmt.Sscanf(strings.TrimSuffix(bitrate, "k"), "%d", &kbps)
+	return kbps
+}
+
 // getVideoResolution obtém a resolução do vídeo usando ffprobe
 func getVideoResolution(videoPath string) (int, int) {
 	cmd := exec.Command("ffprobe",
@@ -966,6 +1523,45 @@ func getVideoResolution(videoPath string) (int, int) {
 	return width, height
 }
 
+// getVideoFrameRate obtém o frame rate do vídeo fonte usando ffprobe (0 = desconhecido).
+// avg_frame_rate é o real em fontes VFR; r_frame_rate é o fallback quando ele não vem preenchido.
+func getVideoFrameRate(videoPath string) float64 {
+	cmd := exec.Command("ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=avg_frame_rate,r_frame_rate",
+		"-of", "default=noprint_wrappers=1",
+		videoPath,
+	)
+
+	output, err := cmd.Output()
+	if err != nil {
+		log.Printf("Erro ao obter frame rate: %v", err)
+		return 0
+	}
+
+	rates := make(map[string]float64)
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if ok {
+			rates[key] = parseFrameRate(value)
+		}
+	}
+	if rate := rates["avg_frame_rate"]; rate > 0 {
+		return rate
+	}
+	return rates["r_frame_rate"]
+}
+
+// parseFrameRate converte a fração do ffprobe ("30000/1001") em quadros por segundo.
+// "0/0" e valores fora do razoável retornam 0.
+func parseFrameRate(value string) float64 {
+	if rate := parseRatio(value, "/"); rate <= 240 {
+		return rate
+	}
+	return 0
+}
+
 // canReadVideoFile verifica se o FFmpeg consegue ler o arquivo de vídeo
 // Usa timeout curto para não bloquear
 func canReadVideoFile(videoPath string) bool {
@@ -993,42 +1589,60 @@ func countSegmentsInDir(dir string) int {
 	}
 	count := 0
 	for _, f := range files {
-		if strings.HasSuffix(f.Name(), ".ts") {
+		if isVideoSegment(f.Name()) {
 			count++
 		}
 	}
 	return count
 }
 
+// GetStream busca um stream pelo ID da sessão do espectador ou pelo ID do próprio stream
 func GetStream(id string) (*StreamInfo, bool) {
-	mu.RLock()
-	defer mu.RUnlock()
+	mu.Lock()
+	defer mu.Unlock()
+	if session, ok := sessions[id]; ok {
+		// Toda rota do espectador passa por aqui: vale como heartbeat da sessão
+		session.LastSeen = time.Now()
+		sessions[id] = session
+		id = session.StreamID
+	}
 	stream, ok := streams[id]
 	return stream, ok
 }
 
+// StopStream encerra uma sessão de espectador. O stream (torrent, FFmpeg e arquivos)
+// só é removido quando o último espectador sai. O ID do stream é conhecido por todos os
+// espectadores e não encerra nada (ErrStopBySession).
 func StopStream(id string) error {
 	mu.Lock()
 	defer mu.Unlock()
 
-	stream, ok := streams[id]
+	session, ok := sessions[id]
 	if !ok {
+		if _, ok := streams[id]; ok {
+			return ErrStopBySession
+		}
 		return fmt.Errorf("stream não encontrado")
 	}
 
-	// Sinalizar cancelamento
-	select {
-	case <-stream.cancelChan:
-		// Já fechado
-	default:
-		close(stream.cancelChan)
+	delete(sessions, id)
+	stream, ok := streams[session.StreamID]
+	if !ok {
+		return nil
+	}
+	stream.viewers--
+	if stream.viewers > 0 {
+		log.Printf("[%s] 👋 Espectador saiu (%d restantes)", session.StreamID[:8], stream.viewers)
+		return nil
 	}
+	id = session.StreamID
+
+	// Sinalizar cancelamento
+	stream.cancel()
 
 	// Matar processos FFmpeg
 	for _, cmd := range stream.ffmpegProcs {
-		if cmd != nil && cmd.Process != nil {
-			cmd.Process.Kill()
-		}
+		stopFFmpeg(cmd)
 	}
 
 	// Remover torrent de forma segura
@@ -1047,7 +1661,7 @@ func StopStream(id string) error {
 	hlsDir := filepath.Join("./downloads", id)
 	os.RemoveAll(hlsDir)
 
-	delete(streams, id)
+	forgetStreamLocked(stream)
 	log.Printf("[%s] Stream removido", id[:8])
 
 	return nil
@@ -1058,12 +1672,7 @@ func CleanupAll() {
 	defer mu.Unlock()
 
 	for id, stream := range streams {
-		select {
-		case <-stream.cancelChan:
-			// Já fechado
-		default:
-			close(stream.cancelChan)
-		}
+		stream.cancel()
 		
 		if stream.torrent != nil {
 			func() {
@@ -1090,6 +1699,8 @@ func CleanupAll() {
 	}
 
 	streams = make(map[string]*StreamInfo)
+	byHash = make(map[string]string)
+	sessions = make(map[string]viewerSession)
 	log.Println("Todos os streams e downloads foram limpos")
 }
 
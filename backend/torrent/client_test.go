@@ -0,0 +1,181 @@
+package torrent
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestOldestEvictableSkipsWatchedStreams(t *testing.T) {
+	oldSession, old := RegisterTestStream(strings.Repeat("01", 20), "", nil)
+	defer RemoveTestStream(old)
+	_, recent := RegisterTestStream(strings.Repeat("02", 20), "", nil)
+	defer RemoveTestStream(recent)
+	old.CreatedAt = time.Now().Add(-time.Hour)
+
+	// Os dois com espectadores ativos: nenhum pode ser removido
+	mu.Lock()
+	evicted := oldestEvictableLocked()
+	mu.Unlock()
+	if evicted != nil {
+		t.Fatalf("stream %s com espectador ativo escolhido para remoção", evicted.ID[:8])
+	}
+
+	// A sessão do stream antigo para de fazer requisições (aba fechada sem DELETE)
+	mu.Lock()
+	session := sessions[oldSession]
+	session.LastSeen = time.Now().Add(-sessionIdleTimeout - time.Minute)
+	sessions[oldSession] = session
+	evicted = oldestEvictableLocked()
+	_, stillThere := sessions[oldSession]
+	mu.Unlock()
+
+	if evicted != old {
+		t.Fatalf("stream com sessão ociosa não foi escolhido para remoção")
+	}
+	if stillThere || old.Viewers() != 0 {
+		t.Errorf("sessão ociosa não foi encerrada (%d espectadores)", old.Viewers())
+	}
+
+	// A sessão encerrada não é mais um ID válido
+	if _, ok := GetStream(oldSession); ok {
+		t.Error("sessão encerrada ainda encontra o stream")
+	}
+}
+
+func TestGetStreamRefreshesSession(t *testing.T) {
+	sessionID, stream := RegisterTestStream(strings.Repeat("03", 20), "", nil)
+	defer RemoveTestStream(stream)
+
+	mu.Lock()
+	session := sessions[sessionID]
+	session.LastSeen = time.Now().Add(-sessionIdleTimeout - time.Minute)
+	sessions[sessionID] = session
+	mu.Unlock()
+
+	if _, ok := GetStream(sessionID); !ok {
+		t.Fatal("sessão não encontrada")
+	}
+
+	mu.Lock()
+	evicted := oldestEvictableLocked()
+	mu.Unlock()
+	if evicted != nil {
+		t.Error("sessão ativa de novo foi tratada como abandonada")
+	}
+}
+
+// testTorrentFile gera um .torrent de um arquivo só, com o dicionário info dado
+func testTorrentFile(t *testing.T, info any) []byte {
+	t.Helper()
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := bencode.Marshal(metainfo.MetaInfo{InfoBytes: infoBytes, Announce: "udp://tracker.example:1337/announce"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestLoadTorrentFile(t *testing.T) {
+	valid := testTorrentFile(t, metainfo.Info{Name: "video.mkv", PieceLength: 16384, Pieces: make([]byte, 20), Length: 1000})
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"válido", valid, ""},
+		{"não é bencode", []byte("isto não é um torrent"), "arquivo .torrent inválido"},
+		{"vazio", nil, "arquivo .torrent inválido"},
+		{"info sem dicionário", testTorrentFile(t, 42), "metadados do .torrent inválidos"},
+	}
+	for _, tt := range tests {
+		mi, err := LoadTorrentFile(bytes.NewReader(tt.data))
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			} else if info, _ := mi.UnmarshalInfo(); info.Name != "video.mkv" {
+				t.Errorf("%s: nome = %q, esperado video.mkv", tt.name, info.Name)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, esperado %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestParseInput(t *testing.T) {
+	hash := "08ada5a7a6183aae1e09d831df6748d566095a10"
+	tests := []struct {
+		input  string
+		prefix string
+	}{
+		{hash, "magnet:?xt=urn:btih:" + hash + "&tr="},
+		{"  " + strings.ToUpper(hash) + "\n", "magnet:?xt=urn:btih:" + strings.ToUpper(hash) + "&tr="},
+		{"magnet:?xt=urn:btih:" + hash, "magnet:?xt=urn:btih:" + hash},
+		{hash[:39], hash[:39]}, // Não é hash: segue adiante e falha como magnet inválido
+		{strings.Repeat("z", 40), strings.Repeat("z", 40)},
+	}
+	for _, tt := range tests {
+		if got := ParseInput(tt.input); !strings.HasPrefix(got, tt.prefix) {
+			t.Errorf("ParseInput(%q) = %q, esperado prefixo %q", tt.input, got, tt.prefix)
+		}
+	}
+}
+
+func TestGenerateMasterPlaylistAudio(t *testing.T) {
+	stream := newTestStream(StateTranscoding)
+	stream.hlsPath = t.TempDir()
+	stream.media.FrameRate = 24
+	stream.audioRenditions = []AudioRendition{
+		{Name: "audio0", Group: stereoGroup, Codec: "copy", Channels: 2, Bitrate: "192k", Track: AudioTrackInfo{Language: "por", Codec: "aac"}},
+		{Name: "audio1", Group: stereoGroup, Codec: "aac", Channels: 2, Bitrate: "128k", Track: AudioTrackInfo{Index: 1, Language: "eng", Title: `Diretor "comenta"`}},
+		{Name: "surround1", Group: surroundGroup, Codec: "copy", Channels: 6, Bitrate: "640k", Track: AudioTrackInfo{Index: 1, Language: "eng", Codec: "ac3"}},
+	}
+	qualities := []QualityLevel{
+		{Name: "360p", Width: 640, Height: 360, Bitrate: "800k", MaxBitrate: "856k"},
+		{Name: "720p", Width: 1280, Height: 720, Bitrate: "2800k", MaxBitrate: "2996k"},
+	}
+
+	if err := generateMasterPlaylist(stream, qualities); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(stream.hlsPath, "master.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	master := string(data)
+
+	// Cada faixa tem URI própria; uma faixa padrão por grupo
+	for _, line := range []string{
+		`#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="Português",LANGUAGE="por",DEFAULT=YES,AUTOSELECT=YES,CHANNELS="2",URI="audio0/playlist.m3u8"`,
+		`#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="Diretor 'comenta'",LANGUAGE="eng",DEFAULT=NO,AUTOSELECT=YES,CHANNELS="2",URI="audio1/playlist.m3u8"`,
+		`#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="surround",NAME="English (5.1)",LANGUAGE="eng",DEFAULT=YES,AUTOSELECT=YES,CHANNELS="6",URI="surround1/playlist.m3u8"`,
+		// Variantes só de vídeo, anunciadas uma vez por grupo: BANDWIDTH soma o maior áudio do grupo
+		`#EXT-X-STREAM-INF:BANDWIDTH=992000,RESOLUTION=640x360,CODECS="avc1.4d4028,mp4a.40.2",NAME="360p",AUDIO="audio"`,
+		`#EXT-X-STREAM-INF:BANDWIDTH=3440000,RESOLUTION=1280x720,CODECS="avc1.4d4028,ac-3",NAME="720p surround",AUDIO="surround"`,
+	} {
+		if !strings.Contains(master, line+"\n") {
+			t.Errorf("master sem a linha:\n%s\n\n%s", line, master)
+		}
+	}
+	if n := strings.Count(master, "\n720p/playlist.m3u8\n"); n != 2 {
+		t.Errorf("720p anunciada %d vezes, esperado 2 (um por grupo de áudio)", n)
+	}
+
+	// O filtro por espectador remove variantes, nunca as faixas de áudio
+	filtered := string(FilterMasterPlaylist(data, qualities[:1]))
+	if strings.Contains(filtered, "720p/playlist.m3u8") || strings.Count(filtered, "TYPE=AUDIO") != 3 {
+		t.Errorf("master filtrado inesperado:\n%s", filtered)
+	}
+}
@@ -0,0 +1,285 @@
+package torrent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// Intervalo de verificação do arquivo de configuração (recarga a quente)
+const configReloadInterval = 5 * time.Second
+
+// Frame rate assumido quando o ffprobe não informa o da fonte
+const defaultFrameRate = 24.0
+
+// EncodingConfig define a escada ABR e as opções de codificação.
+// Carregada de um arquivo JSON (ENCODING_CONFIG); campos omitidos mantêm o padrão.
+type EncodingConfig struct {
+	SegmentDuration int            `json:"segmentDuration"` // -hls_time em segundos
+	GOP             int            `json:"gop"`             // -g / -keyint_min em frames (0 = derivado do frame rate)
+	Audio           AudioConfig    `json:"audio"`
+	Qualities       []QualityLevel `json:"qualities"` // Da menor para a maior
+}
+
+// AudioConfig define a saída das faixas de áudio (uma playlist por faixa, compartilhada pelas qualidades)
+type AudioConfig struct {
+	Channels        int    `json:"channels"`        // -ac
+	SampleRate      int    `json:"sampleRate"`      // -ar
+	Bitrate         string `json:"bitrate"`         // -b:a do AAC estéreo
+	Surround        string `json:"surround"`        // off, passthrough ou aac (rendition multicanal)
+	SurroundBitrate string `json:"surroundBitrate"` // -b:a do AAC multicanal
+}
+
+var (
+	encodingConfig     = defaultEncodingConfig()
+	encodingConfigMu   sync.RWMutex
+	encodingConfigOnce sync.Once
+)
+
+// Presets aceitos pelo libx264 (usados no encoding por software)
+var x264Presets = map[string]bool{
+	"ultrafast": true, "superfast": true, "veryfast": true, "faster": true, "fast": true,
+	"medium": true, "slow": true, "slower": true, "veryslow": true,
+}
+
+var (
+	qualityNamePattern = regexp.MustCompile(`^[0-9A-Za-z]+$`)
+	bitratePattern     = regexp.MustCompile(`^[1-9][0-9]*k$`)
+	reservedRendition  = regexp.MustCompile(`^(original|sub[0-9]+|audio[0-9]+|surround[0-9]+|thumbs)$`) // Remux, legendas, áudio e miniaturas
+)
+
+func defaultEncodingConfig() *EncodingConfig {
+	return &EncodingConfig{
+		SegmentDuration: 2,
+		GOP:             0,
+		Audio:           AudioConfig{Channels: 2, SampleRate: 48000, Bitrate: "128k", Surround: SurroundOff, SurroundBitrate: "384k"},
+		Qualities:       append([]QualityLevel(nil), defaultQualityLevels...),
+	}
+}
+
+// currentEncodingConfig retorna a configuração em vigor (não deve ser alterada)
+func currentEncodingConfig() *EncodingConfig {
+	encodingConfigMu.RLock()
+	defer encodingConfigMu.RUnlock()
+	return encodingConfig
+}
+
+// LoadEncodingConfig carrega a configuração de codificação do arquivo e passa a
+// recarregá-la quando ele mudar. Uma recarga inválida é ignorada (mantém a anterior).
+// Streams em andamento continuam com a configuração com que começaram.
+func LoadEncodingConfig(path string) error {
+	cfg, modTime, err := readEncodingConfig(path)
+	if err != nil {
+		return err
+	}
+
+	encodingConfigMu.Lock()
+	encodingConfig = cfg
+	encodingConfigMu.Unlock()
+	log.Printf("🎛️ Configuração de codificação carregada de %s (%d qualidades)", path, len(cfg.Qualities))
+
+	encodingConfigOnce.Do(func() {
+		go watchEncodingConfig(path, modTime)
+	})
+	return nil
+}
+
+// readEncodingConfig lê e valida o arquivo sobre os valores padrão
+func readEncodingConfig(path string) (*EncodingConfig, time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	cfg := defaultEncodingConfig()
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields() // Erros de digitação não passam em silêncio
+	if err := decoder.Decode(cfg); err != nil {
+		return nil, time.Time{}, fmt.Errorf("%s: %v", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, time.Time{}, fmt.Errorf("%s: %v", path, err)
+	}
+	return cfg, info.ModTime(), nil
+}
+
+// watchEncodingConfig recarrega o arquivo quando a data de modificação muda
+func watchEncodingConfig(path string, lastMod time.Time) {
+	ticker := time.NewTicker(configReloadInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().Equal(lastMod) {
+			continue
+		}
+		lastMod = info.ModTime()
+
+		cfg, _, err := readEncodingConfig(path)
+		if err != nil {
+			log.Printf("⚠️ Configuração de codificação inválida, mantendo a anterior: %v", err)
+			continue
+		}
+
+		encodingConfigMu.Lock()
+		encodingConfig = cfg
+		encodingConfigMu.Unlock()
+		log.Printf("🔄 Configuração de codificação recarregada (%d qualidades)", len(cfg.Qualities))
+	}
+}
+
+// validate confere a configuração inteira antes de ela entrar em vigor
+func (c *EncodingConfig) validate() error {
+	if c.SegmentDuration < 1 || c.SegmentDuration > 10 {
+		return fmt.Errorf("segmentDuration deve estar entre 1 e 10 segundos")
+	}
+	if c.GOP < 0 {
+		return fmt.Errorf("gop não pode ser negativo")
+	}
+	if c.Audio.Channels < 1 || c.Audio.Channels > 8 {
+		return fmt.Errorf("audio.channels deve estar entre 1 e 8")
+	}
+	if c.Audio.SampleRate != 44100 && c.Audio.SampleRate != 48000 {
+		return fmt.Errorf("audio.sampleRate deve ser 44100 ou 48000")
+	}
+	if !bitratePattern.MatchString(c.Audio.Bitrate) {
+		return fmt.Errorf("audio.bitrate deve estar no formato \"128k\"")
+	}
+	switch c.Audio.Surround {
+	case SurroundOff, SurroundPassthrough, SurroundAAC:
+	default:
+		return fmt.Errorf("audio.surround deve ser %s, %s ou %s", SurroundOff, SurroundPassthrough, SurroundAAC)
+	}
+	if !bitratePattern.MatchString(c.Audio.SurroundBitrate) {
+		return fmt.Errorf("audio.surroundBitrate deve estar no formato \"384k\"")
+	}
+	if len(c.Qualities) == 0 {
+		return fmt.Errorf("a escada precisa de ao menos uma qualidade")
+	}
+
+	seen := make(map[string]bool)
+	for i, q := range c.Qualities {
+		if !qualityNamePattern.MatchString(q.Name) || reservedRendition.MatchString(q.Name) {
+			return fmt.Errorf("qualities[%d]: nome inválido %q", i, q.Name)
+		}
+		if seen[q.Name] {
+			return fmt.Errorf("qualities[%d]: nome repetido %q", i, q.Name)
+		}
+		seen[q.Name] = true
+
+		if q.Width <= 0 || q.Height <= 0 || q.Width%2 != 0 || q.Height%2 != 0 {
+			return fmt.Errorf("%s: largura/altura devem ser positivas e pares", q.Name)
+		}
+		if i > 0 && q.Height <= c.Qualities[i-1].Height {
+			return fmt.Errorf("%s: qualidades devem estar em ordem crescente de altura", q.Name)
+		}
+		for field, value := range map[string]string{
+			"bitrate": q.Bitrate, "maxBitrate": q.MaxBitrate, "bufSize": q.BufSize,
+		} {
+			if !bitratePattern.MatchString(value) {
+				return fmt.Errorf("%s: %s deve estar no formato \"1400k\"", q.Name, field)
+			}
+		}
+		if q.CRF < 0 || q.CRF > 51 {
+			return fmt.Errorf("%s: crf deve estar entre 0 e 51", q.Name)
+		}
+		if !x264Presets[q.Preset] {
+			return fmt.Errorf("%s: preset inválido %q", q.Name, q.Preset)
+		}
+	}
+	return nil
+}
+
+// gopFor retorna o intervalo máximo entre keyframes para a fonte.
+// Sem GOP fixo, cobre exatamente um segmento: arredondado para cima, o limite natural nunca
+// dispara antes do keyframe forçado na fronteira (ex: 29,97fps x 2s = 60 frames).
+func (c *EncodingConfig) gopFor(frameRate float64) int {
+	if c.GOP > 0 {
+		return c.GOP
+	}
+	if frameRate <= 0 {
+		frameRate = defaultFrameRate
+	}
+	return int(math.Ceil(frameRate*float64(c.SegmentDuration) - 1e-6))
+}
+
+// findQuality busca uma qualidade da escada configurada pelo nome
+func (c *EncodingConfig) findQuality(name string) (QualityLevel, bool) {
+	for _, q := range c.Qualities {
+		if q.Name == name {
+			return q, true
+		}
+	}
+	return QualityLevel{}, false
+}
+
+// heightLimits converte os limites pedidos pelo cliente em alturas (0 = sem limite)
+func (c *EncodingConfig) heightLimits(minQuality, maxQuality string) (minHeight, maxHeight int) {
+	if q, ok := c.findQuality(minQuality); ok {
+		minHeight = q.Height
+	}
+	if q, ok := c.findQuality(maxQuality); ok {
+		maxHeight = q.Height
+	}
+	return minHeight, maxHeight
+}
+
+// ladderFor retorna as qualidades que não excedem a altura da fonte, dentro dos limites
+// pedidos. Se nada sobrar, usa a menor qualidade permitida.
+func (c *EncodingConfig) ladderFor(sourceHeight int, minQuality, maxQuality string) []QualityLevel {
+	minHeight, maxHeight := c.heightLimits(minQuality, maxQuality)
+
+	var allowed []QualityLevel
+	for _, q := range c.Qualities {
+		if q.Height < minHeight || (maxHeight > 0 && q.Height > maxHeight) {
+			continue
+		}
+		allowed = append(allowed, q)
+	}
+	if len(allowed) == 0 {
+		allowed = c.Qualities[:1]
+	}
+
+	var ladder []QualityLevel
+	for _, q := range allowed {
+		if q.Height <= sourceHeight {
+			ladder = append(ladder, q)
+		}
+	}
+	if len(ladder) == 0 {
+		ladder = []QualityLevel{allowed[0]}
+	}
+	return ladder
+}
+
+// ValidateQualityRange confere os limites de qualidade pedidos pelo cliente
+func ValidateQualityRange(minQuality, maxQuality string) error {
+	cfg := currentEncodingConfig()
+
+	var minQ, maxQ QualityLevel
+	var ok bool
+	if minQuality != "" {
+		if minQ, ok = cfg.findQuality(minQuality); !ok {
+			return fmt.Errorf("minQuality desconhecida: %s", minQuality)
+		}
+	}
+	if maxQuality != "" {
+		if maxQ, ok = cfg.findQuality(maxQuality); !ok {
+			return fmt.Errorf("maxQuality desconhecida: %s", maxQuality)
+		}
+	}
+	if minQuality != "" && maxQuality != "" && minQ.Height > maxQ.Height {
+		return fmt.Errorf("minQuality (%s) é maior que maxQuality (%s)", minQuality, maxQuality)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package torrent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadEncodingConfig(t *testing.T) {
+	// O exemplo do repositório precisa continuar válido
+	if _, _, err := readEncodingConfig(filepath.Join("..", "encoding.example.json")); err != nil {
+		t.Fatalf("encoding.example.json: %v", err)
+	}
+
+	quality := `{"name": "720p", "width": 1280, "height": 720, "bitrate": "2800k", "maxBitrate": "2996k", "bufSize": "4200k", "crf": 24, "preset": "fast"}`
+	tests := []struct {
+		name    string
+		json    string
+		wantErr string
+	}{
+		{"campos omitidos mantêm o padrão", `{"segmentDuration": 4}`, ""},
+		{"escada própria", `{"qualities": [` + quality + `]}`, ""},
+		{"campo desconhecido", `{"segmentDurations": 4}`, "unknown field"},
+		{"segmento longo demais", `{"segmentDuration": 11}`, "segmentDuration"},
+		{"gop negativo", `{"gop": -1}`, "gop"},
+		{"taxa de amostragem", `{"audio": {"sampleRate": 22050}}`, "audio.sampleRate"},
+		{"surround desconhecido", `{"audio": {"surround": "dts"}}`, "audio.surround"},
+		{"escada vazia", `{"qualities": []}`, "ao menos uma qualidade"},
+		{"nome reservado", `{"qualities": [` + strings.Replace(quality, `"720p"`, `"audio0"`, 1) + `]}`, "nome inválido"},
+		{"nome repetido", `{"qualities": [` + quality + `, ` + quality + `]}`, "nome repetido"},
+		{"largura ímpar", `{"qualities": [` + strings.Replace(quality, "1280", "1279", 1) + `]}`, "pares"},
+		{"fora de ordem", `{"qualities": [` + quality + `, ` + strings.NewReplacer(`"720p"`, `"360p"`, "1280", "640", "720,", "360,").Replace(quality) + `]}`, "ordem crescente"},
+		{"bitrate sem k", `{"qualities": [` + strings.Replace(quality, `"2800k"`, `"2800"`, 1) + `]}`, "bitrate"},
+		{"preset inválido", `{"qualities": [` + strings.Replace(quality, `"fast"`, `"turbo"`, 1) + `]}`, "preset"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "encoding.json")
+		if err := os.WriteFile(path, []byte(tt.json), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, _, err := readEncodingConfig(path)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			} else if cfg.Audio.SampleRate != 48000 || len(cfg.Qualities) == 0 {
+				t.Errorf("%s: padrões perdidos: %+v", tt.name, cfg)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, esperado %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLadderFor(t *testing.T) {
+	cfg := defaultEncodingConfig()
+	names := func(ladder []QualityLevel) string {
+		var list []string
+		for _, q := range ladder {
+			list = append(list, q.Name)
+		}
+		return strings.Join(list, ",")
+	}
+
+	tests := []struct {
+		source     int
+		minQuality string
+		maxQuality string
+		want       string
+	}{
+		{1080, "", "", "240p,360p,480p,720p,1080p"},
+		{720, "480p", "", "480p,720p"},
+		{2160, "", "720p", "240p,360p,480p,720p"},
+		{2160, "480p", "720p", "480p,720p"},
+		// Fonte menor que a escada: a menor qualidade permitida
+		{144, "", "", "240p"},
+		{360, "720p", "", "720p"},
+		// Limites desconhecidos são ignorados (ValidateQualityRange os recusa antes)
+		{1080, "999p", "", "240p,360p,480p,720p,1080p"},
+	}
+	for _, tt := range tests {
+		if got := names(cfg.ladderFor(tt.source, tt.minQuality, tt.maxQuality)); got != tt.want {
+			t.Errorf("fonte %dp, limites [%s, %s]: %s, esperado %s", tt.source, tt.minQuality, tt.maxQuality, got, tt.want)
+		}
+	}
+}
+
+func TestValidateQualityRange(t *testing.T) {
+	tests := []struct {
+		minQuality string
+		maxQuality string
+		ok         bool
+	}{
+		{"", "", true},
+		{"480p", "", true},
+		{"480p", "1080p", true},
+		{"720p", "720p", true},
+		{"1080p", "480p", false},
+		{"4k", "", false},
+		{"", "8k", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateQualityRange(tt.minQuality, tt.maxQuality); (err == nil) != tt.ok {
+			t.Errorf("[%s, %s]: err = %v", tt.minQuality, tt.maxQuality, err)
+		}
+	}
+}
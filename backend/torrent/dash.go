@@ -0,0 +1,177 @@
+package torrent
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+)
+
+// ErrDASHRequiresFMP4 indica que o manifesto DASH só existe com segmentos fMP4 (CMAF)
+var ErrDASHRequiresFMP4 = errors.New("DASH requer SEGMENT_FORMAT=fmp4")
+
+// Buffer mínimo anunciado no manifesto. Os CODECS são os mesmos do master playlist:
+// vídeo por qualidade (ver videoCodecs) e áudio por rendition (ver AudioRendition.hlsCodec).
+const dashMinBufferTime = "PT4S"
+
+// Esquemas de descritores DASH
+const (
+	dashChannelScheme = "urn:mpeg:dash:23003:3:audio_channel_configuration:2011"
+	dashRoleScheme    = "urn:mpeg:dash:role:2011"
+)
+
+type dashMPD struct {
+	XMLName                   xml.Name   `xml:"MPD"`
+	Xmlns                     string     `xml:"xmlns,attr"`
+	Profiles                  string     `xml:"profiles,attr"`
+	Type                      string     `xml:"type,attr"`
+	MediaPresentationDuration string     `xml:"mediaPresentationDuration,attr"`
+	MinBufferTime             string     `xml:"minBufferTime,attr"`
+	Period                    dashPeriod `xml:"Period"`
+}
+
+type dashPeriod struct {
+	ID             string              `xml:"id,attr"`
+	Start          string              `xml:"start,attr"`
+	AdaptationSets []dashAdaptationSet `xml:"AdaptationSet"`
+}
+
+type dashAdaptationSet struct {
+	ID               int                  `xml:"id,attr"`
+	ContentType      string               `xml:"contentType,attr"`
+	MimeType         string               `xml:"mimeType,attr"`
+	Lang             string               `xml:"lang,attr,omitempty"`
+	SegmentAlignment bool                 `xml:"segmentAlignment,attr"`
+	StartWithSAP     int                  `xml:"startWithSAP,attr"`
+	Label            string               `xml:"Label,omitempty"`
+	Role             *dashDescriptor      `xml:"Role,omitempty"`
+	SegmentTemplate  dashSegmentTemplate  `xml:"SegmentTemplate"`
+	Representations  []dashRepresentation `xml:"Representation"`
+}
+
+type dashDescriptor struct {
+	SchemeIDURI string `xml:"schemeIdUri,attr"`
+	Value       string `xml:"value,attr"`
+}
+
+type dashSegmentTemplate struct {
+	Timescale      int    `xml:"timescale,attr"`
+	Duration       int    `xml:"duration,attr"`
+	StartNumber    int    `xml:"startNumber,attr"`
+	Media          string `xml:"media,attr"`
+	Initialization string `xml:"initialization,attr"`
+}
+
+type dashRepresentation struct {
+	ID            string          `xml:"id,attr"`
+	Bandwidth     int             `xml:"bandwidth,attr"`
+	Width         int             `xml:"width,attr,omitempty"`
+	Height        int             `xml:"height,attr,omitempty"`
+	Codecs        string          `xml:"codecs,attr"`
+	AudioChannels *dashDescriptor `xml:"AudioChannelConfiguration,omitempty"`
+}
+
+// BuildDASHManifest descreve a escada atual como um MPD estático.
+// As Representations apontam para os mesmos segmentos CMAF do HLS
+// (<qualidade>/segmentNNN.m4s), então os dois protocolos compartilham a transcodificação.
+// O vídeo é um AdaptationSet só de vídeo e cada faixa de áudio tem o seu.
+// Segmentos ainda não gerados são atendidos pela mesma espera/seek do HLS.
+// ladder são as qualidades anunciadas ao espectador (ver ViewerLadder).
+func BuildDASHManifest(stream *StreamInfo, ladder []QualityLevel) ([]byte, error) {
+	if segmentFormat != SegmentFormatFMP4 {
+		return nil, ErrDASHRequiresFMP4
+	}
+
+	media := stream.currentMedia()
+	if len(ladder) == 0 {
+		return nil, fmt.Errorf("escada de qualidades ainda não definida")
+	}
+	if media.Duration <= 0 {
+		return nil, fmt.Errorf("duração do vídeo desconhecida")
+	}
+
+	segmentMs := stream.encodingConfig().SegmentDuration * 1000
+
+	video := dashAdaptationSet{
+		ID:               0,
+		ContentType:      "video",
+		MimeType:         "video/mp4",
+		SegmentAlignment: true,
+		StartWithSAP:     1,
+		SegmentTemplate: dashSegmentTemplate{
+			Timescale:      1000,
+			Duration:       segmentMs,
+			StartNumber:    0,
+			Media:          "$RepresentationID$/segment$Number%03d$.m4s",
+			Initialization: "$RepresentationID$/" + initSegmentName("$RepresentationID$"),
+		},
+	}
+
+	for _, q := range ladder {
+		// A variante sem reencode corta nos keyframes da fonte: nem o alinhamento nem o
+		// $Number$ -> n*duração do SegmentTemplate valem para ela, então fica só no HLS
+		if q.Copy {
+			continue
+		}
+		video.Representations = append(video.Representations, dashRepresentation{
+			ID:        q.Name,
+			Bandwidth: parseKbps(q.Bitrate) * 1000,
+			Width:     q.Width,
+			Height:    q.Height,
+			Codecs:    videoCodecs(q, media.FrameRate),
+		})
+	}
+	if len(video.Representations) == 0 {
+		return nil, fmt.Errorf("nenhuma qualidade reencodada para o manifesto DASH")
+	}
+	sets := []dashAdaptationSet{video}
+
+	// Uma faixa por AdaptationSet: o player escolhe idioma/canais entre eles.
+	// As renditions de áudio rodam sempre em processo próprio, com init.mp4.
+	for i, r := range stream.currentAudioRenditions() {
+		set := dashAdaptationSet{
+			ID:               i + 1,
+			ContentType:      "audio",
+			MimeType:         "audio/mp4",
+			Lang:             r.Track.Language,
+			SegmentAlignment: true,
+			StartWithSAP:     1,
+			Label:            r.displayName(),
+			SegmentTemplate: dashSegmentTemplate{
+				Timescale:      1000,
+				Duration:       segmentMs,
+				StartNumber:    0,
+				Media:          "$RepresentationID$/segment$Number%03d$.m4s",
+				Initialization: "$RepresentationID$/init.mp4",
+			},
+			Representations: []dashRepresentation{{
+				ID:            r.Name,
+				Bandwidth:     parseKbps(r.Bitrate) * 1000,
+				Codecs:        r.hlsCodec(),
+				AudioChannels: &dashDescriptor{SchemeIDURI: dashChannelScheme, Value: fmt.Sprintf("%d", r.Channels)},
+			}},
+		}
+		if i == 0 {
+			set.Role = &dashDescriptor{SchemeIDURI: dashRoleScheme, Value: "main"}
+		}
+		sets = append(sets, set)
+	}
+
+	mpd := dashMPD{
+		Xmlns:                     "urn:mpeg:dash:schema:mpd:2011",
+		Profiles:                  "urn:mpeg:dash:profile:isoff-live:2011",
+		Type:                      "static",
+		MediaPresentationDuration: fmt.Sprintf("PT%.3fS", media.Duration),
+		MinBufferTime:             dashMinBufferTime,
+		Period: dashPeriod{
+			ID:             "0",
+			Start:          "PT0S",
+			AdaptationSets: sets,
+		},
+	}
+
+	out, err := xml.MarshalIndent(mpd, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
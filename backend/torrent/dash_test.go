@@ -0,0 +1,57 @@
+package torrent
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestBuildDASHManifestAudioLabels(t *testing.T) {
+	previous := segmentFormat
+	segmentFormat = SegmentFormatFMP4
+	defer func() { segmentFormat = previous }()
+
+	stream := newTestStream(StateReady)
+	stream.encoding = &EncodingConfig{SegmentDuration: 2}
+	stream.media.Duration = 60
+	stream.media.FrameRate = 59.94
+	ladder := []QualityLevel{
+		{Name: "720p", Width: 1280, Height: 720, Bitrate: "2800k", MaxBitrate: "2996k"},
+		{Name: "1080p", Width: 1920, Height: 1080, Bitrate: "5000k", MaxBitrate: "5350k"},
+	}
+	stream.audioRenditions = []AudioRendition{
+		{Name: "audio0", Group: stereoGroup, Channels: 2, Track: AudioTrackInfo{Language: "por"}},
+		{Name: "audio1", Group: stereoGroup, Channels: 2, Track: AudioTrackInfo{Language: "eng", Title: "Comentários"}},
+		{Name: "surround0", Group: surroundGroup, Channels: 6, Track: AudioTrackInfo{Language: "eng"}},
+	}
+
+	data, err := BuildDASHManifest(stream, ladder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mpd dashMPD
+	if err := xml.Unmarshal(data, &mpd); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mesmos nomes do master playlist: título, ou o idioma quando a faixa não tem título
+	sets := mpd.Period.AdaptationSets
+	want := []string{"Português", "Comentários", "English (5.1)"}
+	if len(sets) != len(want)+1 {
+		t.Fatalf("%d AdaptationSets, esperado %d", len(sets), len(want)+1)
+	}
+	for i, label := range want {
+		if got := sets[i+1].Label; got != label {
+			t.Errorf("faixa %d: Label = %q, esperado %q", i, got, label)
+		}
+		if got := stream.audioRenditions[i].displayName(); got != label {
+			t.Errorf("faixa %d: NAME no master = %q, esperado %q", i, got, label)
+		}
+	}
+
+	// CODECS por qualidade: 1080p a 60fps passa do nível 4.0
+	for i, codecs := range []string{"avc1.4d4028", "avc1.4d402a"} {
+		if got := sets[0].Representations[i].Codecs; got != codecs {
+			t.Errorf("%s: codecs = %q, esperado %q", ladder[i].Name, got, codecs)
+		}
+	}
+}
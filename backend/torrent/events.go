@@ -0,0 +1,144 @@
+package torrent
+
+import (
+	"path/filepath"
+	"time"
+)
+
+// Intervalo de amostragem de velocidade/progresso e de envio de eventos
+const statsInterval = 1 * time.Second
+
+// StreamEvent é um evento enviado aos assinantes de um stream (SSE)
+type StreamEvent struct {
+	Type string      // status, stats ou quality
+	Data interface{} // StatusEvent, StatsEvent ou QualityEvent
+}
+
+// StatusEvent indica uma transição de status (downloading -> transcoding -> ready / error)
+type StatusEvent struct {
+	Status   StreamState `json:"status"`
+	Previous StreamState `json:"previous"`
+	Error    string      `json:"error,omitempty"`
+}
+
+// StatsEvent traz o progresso do download amostrado no servidor
+type StatsEvent struct {
+	Progress   float64 `json:"progress"`
+	Peers      int     `json:"peers"`
+	Downloaded float64 `json:"downloaded"` // MB
+	Speed      float64 `json:"speed"`      // MB/s
+}
+
+// QualityEvent indica que uma qualidade passou a ter segmentos disponíveis
+type QualityEvent struct {
+	Quality string `json:"quality"`
+	Ready   bool   `json:"ready"`
+}
+
+// Subscribe registra um assinante de eventos do stream.
+// A função retornada cancela a assinatura.
+func (s *StreamInfo) Subscribe() (<-chan StreamEvent, func()) {
+	ch := make(chan StreamEvent, 32)
+
+	s.mu.Lock()
+	if s.subscribers == nil {
+		s.subscribers = make(map[chan StreamEvent]struct{})
+	}
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.subscribers, ch)
+		s.mu.Unlock()
+	}
+}
+
+// Done é fechado quando o stream é removido
+func (s *StreamInfo) Done() <-chan struct{} {
+	return s.cancelChan
+}
+
+// publish envia um evento a todos os assinantes sem bloquear
+// (assinantes lentos perdem eventos, o próximo stats os atualiza)
+func (s *StreamInfo) publish(event StreamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.publishLocked(event)
+}
+
+// publishLocked é publish para quem já tem s.mu
+func (s *StreamInfo) publishLocked(event StreamEvent) {
+	for ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// sampleStats amostra velocidade, peers e progresso em um ticker do servidor
+// (independente de quantos clientes consultam o status) e publica os eventos.
+// Eventos de status são publicados pela própria transição (ver state.go).
+func sampleStats(stream *StreamInfo) {
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+
+	readyQualities := make(map[string]bool)
+
+	for {
+		select {
+		case <-stream.cancelChan:
+			return
+		case <-ticker.C:
+		}
+
+		stream.mu.Lock()
+		t := stream.torrent
+		stream.mu.Unlock()
+
+		if t != nil {
+			stats := t.Stats()
+			currentBytes := stats.BytesReadData.Int64()
+			now := time.Now()
+
+			stream.mu.Lock()
+			if !stream.lastSpeedCheck.IsZero() {
+				elapsed := now.Sub(stream.lastSpeedCheck).Seconds()
+				if elapsed > 0 {
+					stream.currentSpeed = float64(currentBytes-stream.lastBytes) / 1024 / 1024 / elapsed // MB/s
+				}
+			}
+			stream.lastBytes = currentBytes
+			stream.lastSpeedCheck = now
+			stream.currentPeers = stats.ActivePeers
+			stream.downloadedMB = float64(currentBytes) / 1024 / 1024
+			stream.mu.Unlock()
+		}
+
+		snap := stream.Snapshot()
+		peers, downloaded, speed := stream.GetPeerStats()
+		stream.publish(StreamEvent{Type: "stats", Data: StatsEvent{
+			Progress:   snap.Progress,
+			Peers:      peers,
+			Downloaded: downloaded,
+			Speed:      speed,
+		}})
+
+		// Prontidão por qualidade (primeiro segmento gerado)
+		stream.mu.Lock()
+		ladder := stream.ladder
+		stream.mu.Unlock()
+		for _, q := range ladder {
+			ready := snap.HLSPath != "" && countSegmentsInDir(filepath.Join(snap.HLSPath, q.Name)) > 0
+			if ready != readyQualities[q.Name] {
+				readyQualities[q.Name] = ready
+				stream.publish(StreamEvent{Type: "quality", Data: QualityEvent{Quality: q.Name, Ready: ready}})
+			}
+		}
+		if len(ladder) == 0 && len(readyQualities) > 0 {
+			// Troca de arquivo: a escada anterior deixou de existir
+			readyQualities = make(map[string]bool)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package torrent
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPublishSkipsSlowSubscribers(t *testing.T) {
+	s := newTestStream(StateDownloading)
+	slow, unsubscribeSlow := s.Subscribe()
+	defer unsubscribeSlow()
+	fast, unsubscribeFast := s.Subscribe()
+
+	// O assinante lento não lê: passar do buffer não pode travar quem publica
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < cap(slow)+10; i++ {
+			s.publish(StreamEvent{Type: "stats", Data: StatsEvent{Progress: float64(i)}})
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publish bloqueou com um assinante lento")
+	}
+
+	if len(slow) != cap(slow) {
+		t.Errorf("assinante lento com %d eventos, esperado o buffer cheio (%d)", len(slow), cap(slow))
+	}
+	if first := <-fast; first.Data.(StatsEvent).Progress != 0 {
+		t.Errorf("primeiro evento = %+v, esperado o progresso 0", first)
+	}
+
+	// Depois de cancelar, o assinante não recebe mais nada
+	unsubscribeFast()
+	for len(fast) > 0 {
+		<-fast
+	}
+	s.publish(StreamEvent{Type: "stats", Data: StatsEvent{}})
+	if len(fast) != 0 {
+		t.Error("assinatura cancelada continuou recebendo eventos")
+	}
+}
@@ -0,0 +1,236 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// Extensões reconhecidas por tipo de mídia
+var (
+	videoExtensions    = []string{".mp4", ".mkv", ".avi", ".mov", ".wmv", ".webm"}
+	audioExtensions    = []string{".mp3", ".flac", ".aac", ".m4a", ".ogg", ".opus", ".wav", ".ac3", ".dts"}
+	subtitleExtensions = []string{".srt", ".ass", ".ssa", ".vtt", ".sub"}
+)
+
+// TorrentFileInfo descreve um arquivo dentro do torrent
+type TorrentFileInfo struct {
+	Index     int    `json:"index"`     // Índice do arquivo em t.Files()
+	Path      string `json:"path"`      // Caminho relativo à raiz do torrent
+	Size      int64  `json:"size"`      // Tamanho em bytes
+	MediaType string `json:"mediaType"` // video, audio, subtitle ou other
+	Selected  bool   `json:"selected"`  // Se é o arquivo sendo reproduzido
+}
+
+// detectMediaType classifica um arquivo pela extensão
+func detectMediaType(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range videoExtensions {
+		if ext == e {
+			return "video"
+		}
+	}
+	for _, e := range subtitleExtensions {
+		if ext == e {
+			return "subtitle"
+		}
+	}
+	for _, e := range audioExtensions {
+		if ext == e {
+			return "audio"
+		}
+	}
+	return "other"
+}
+
+// pickVideoFile escolhe o arquivo a reproduzir.
+// Sem índice explícito, usa o maior arquivo de vídeo (comportamento padrão).
+func pickVideoFile(t *torrent.Torrent, fileIndex *int) (*torrent.File, int, error) {
+	files := t.Files()
+
+	if fileIndex != nil {
+		idx := *fileIndex
+		if idx < 0 || idx >= len(files) {
+			return nil, -1, fmt.Errorf("índice de arquivo inválido: %d", idx)
+		}
+		if detectMediaType(files[idx].Path()) != "video" {
+			return nil, -1, fmt.Errorf("o arquivo %d não é um vídeo", idx)
+		}
+		return files[idx], idx, nil
+	}
+
+	var videoFile *torrent.File
+	videoIndex := -1
+	for i, file := range files {
+		if detectMediaType(file.Path()) != "video" {
+			continue
+		}
+		if videoFile == nil || file.Length() > videoFile.Length() {
+			videoFile = file
+			videoIndex = i
+		}
+	}
+
+	if videoFile == nil {
+		return nil, -1, fmt.Errorf("Nenhum arquivo de vídeo encontrado no torrent")
+	}
+	return videoFile, videoIndex, nil
+}
+
+// WaitFiles aguarda os metadados do torrent e retorna a árvore de arquivos
+func (s *StreamInfo) WaitFiles(ctx context.Context) ([]TorrentFileInfo, error) {
+	// O torrent é adicionado em background por downloadAndTranscode
+	var t *torrent.Torrent
+	for t == nil {
+		s.mu.Lock()
+		t = s.torrent
+		s.mu.Unlock()
+		if t != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timeout aguardando torrent")
+		case <-s.cancelChan:
+			return nil, fmt.Errorf("stream cancelado")
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+
+	select {
+	case <-t.GotInfo():
+	case <-ctx.Done():
+		return nil, fmt.Errorf("timeout aguardando metadados do torrent")
+	case <-s.cancelChan:
+		return nil, fmt.Errorf("stream cancelado")
+	}
+
+	s.mu.Lock()
+	selected := s.media.FileIndex
+	s.mu.Unlock()
+
+	files := t.Files()
+	result := make([]TorrentFileInfo, 0, len(files))
+	for i, f := range files {
+		result = append(result, TorrentFileInfo{
+			Index:     i,
+			Path:      f.Path(),
+			Size:      f.Length(),
+			MediaType: detectMediaType(f.Path()),
+			Selected:  i == selected,
+		})
+	}
+	return result, nil
+}
+
+// selectFile marca o arquivo escolhido para download e desativa os demais.
+// Retorna o canal de cancelamento do pipeline (download/transcodificação) desse arquivo.
+func (s *StreamInfo) selectFile(file *torrent.File, index int) chan struct{} {
+	s.mu.Lock()
+	t := s.torrent
+	s.mu.Unlock()
+	sidecars := findSidecarSubtitles(t, file)
+
+	s.mu.Lock()
+	if s.fileDone != nil {
+		select {
+		case <-s.fileDone:
+		default:
+			close(s.fileDone)
+		}
+	}
+	done := make(chan struct{})
+	s.fileDone = done
+	s.media.FileIndex = index
+	s.sidecars = sidecars
+	s.mu.Unlock()
+
+	// Arquivos não escolhidos nunca são baixados.
+	// CancelPieces limpa prioridades definidas peça a peça (ex: bloco inicial de outro arquivo).
+	for _, f := range t.Files() {
+		if f == file || isSidecarOf(f, sidecars) {
+			continue
+		}
+		f.SetPriority(torrent.PiecePriorityNone)
+		t.CancelPieces(f.BeginPieceIndex(), f.EndPieceIndex())
+	}
+
+	// Legendas externas são pequenas: baixar com prioridade para estarem prontas junto com o vídeo
+	for _, f := range sidecars {
+		f.SetPriority(torrent.PiecePriorityHigh)
+	}
+
+	return done
+}
+
+func isSidecarOf(f *torrent.File, sidecars []*torrent.File) bool {
+	for _, s := range sidecars {
+		if s == f {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectFile troca o arquivo reproduzido por um stream já iniciado.
+// Só é permitido enquanto há um único espectador (ErrViewerConflict).
+func SelectFile(id string, fileIndex int) error {
+	stream, ok := GetStream(id)
+	if !ok {
+		return fmt.Errorf("stream não encontrado")
+	}
+
+	stream.mu.Lock()
+	t := stream.torrent
+	current := stream.media.FileIndex
+	stream.mu.Unlock()
+
+	if t == nil || t.Info() == nil {
+		return fmt.Errorf("metadados do torrent ainda não disponíveis")
+	}
+	if fileIndex == current {
+		return nil
+	}
+
+	videoFile, index, err := pickVideoFile(t, &fileIndex)
+	if err != nil {
+		return err
+	}
+
+	// O stream é compartilhado: trocar o arquivo trocaria o vídeo de todos os espectadores.
+	// mu fica com a troca até o novo arquivo estar registrado: quem entrar depois já o vê
+	// (ver joinStreamLocked) e não é trocado junto.
+	mu.Lock()
+	if stream.viewers > 1 {
+		viewers := stream.viewers
+		mu.Unlock()
+		return fmt.Errorf("%w: %d espectadores assistem a este stream, o arquivo não pode ser trocado", ErrViewerConflict, viewers)
+	}
+
+	log.Printf("[%s] 🔀 Trocando arquivo: %d -> %d (%s)", stream.ID[:8], current, index, videoFile.Path())
+
+	done := stream.selectFile(videoFile, index)
+
+	// Parar transcodificações do arquivo anterior
+	for _, cmd := range stream.ffmpegProcs {
+		stopFFmpeg(cmd)
+	}
+	stream.ffmpegProcs = nil
+	mu.Unlock()
+
+	// Volta para downloading (válido a partir de qualquer estado, inclusive erro)
+	stream.resetForFile()
+
+	// Descartar HLS do arquivo anterior
+	os.RemoveAll(filepath.Join("./downloads", stream.ID, "hls"))
+
+	go playFile(stream, videoFile, done)
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package torrent
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// newTestTorrent adiciona a um cliente local (sem rede) um torrent com os arquivos dados
+// (caminho -> tamanho). t.Files() fica disponível na hora, como num .torrent enviado.
+func newTestTorrent(t *testing.T, files map[string]int64) *torrent.Torrent {
+	t.Helper()
+
+	info := metainfo.Info{Name: "pack", PieceLength: 16384}
+	var total int64
+	for p, size := range files {
+		info.Files = append(info.Files, metainfo.FileInfo{Path: strings.Split(p, "/"), Length: size})
+		total += size
+	}
+	info.Pieces = make([]byte, 20*((total+info.PieceLength-1)/info.PieceLength))
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := torrent.NewDefaultClientConfig()
+	cfg.DataDir = t.TempDir()
+	cfg.ListenPort = 0
+	cfg.NoDHT = true
+	cfg.DisableTrackers = true
+	cfg.DisableTCP = true
+	cfg.DisableUTP = true
+	cl, err := torrent.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { cl.Close() })
+
+	tt, err := cl.AddTorrent(&metainfo.MetaInfo{InfoBytes: infoBytes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tt
+}
+
+// filePath é o caminho de um arquivo do torrent sem a pasta raiz
+func filePath(f *torrent.File) string {
+	return strings.TrimPrefix(f.Path(), "pack/")
+}
+
+func TestDetectMediaType(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"Filme.mkv", "video"},
+		{"Filme.MP4", "video"},
+		{"Pasta/Episódio 01.webm", "video"},
+		{"Filme.pt-BR.srt", "subtitle"},
+		{"Filme.idx.sub", "subtitle"},
+		{"Trilha/01 - Tema.flac", "audio"},
+		{"Filme.dts", "audio"},
+		{"LEIAME.txt", "other"},
+		{"sample", "other"},
+	}
+	for _, tt := range tests {
+		if got := detectMediaType(tt.path); got != tt.want {
+			t.Errorf("detectMediaType(%q) = %q, esperado %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestPickVideoFile(t *testing.T) {
+	tor := newTestTorrent(t, map[string]int64{
+		"Extras/Trailer.mp4":   3000,
+		"Filme.mkv":            9000,
+		"Filme.srt":            100,
+		"Trilha/01 - Tema.mp3": 20000,
+	})
+	index := func(p string) *int {
+		for i, f := range tor.Files() {
+			if filePath(f) == p {
+				return &i
+			}
+		}
+		t.Fatalf("%s não está no torrent", p)
+		return nil
+	}
+	invalid := len(tor.Files())
+
+	tests := []struct {
+		name      string
+		fileIndex *int
+		want      string
+		wantErr   string
+	}{
+		{"maior vídeo por padrão (áudio maior é ignorado)", nil, "Filme.mkv", ""},
+		{"vídeo escolhido", index("Extras/Trailer.mp4"), "Extras/Trailer.mp4", ""},
+		{"legenda não é vídeo", index("Filme.srt"), "", "não é um vídeo"},
+		{"índice fora do torrent", &invalid, "", "índice de arquivo inválido"},
+	}
+	for _, tt := range tests {
+		f, i, err := pickVideoFile(tor, tt.fileIndex)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, esperado %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if filePath(f) != tt.want || tor.Files()[i] != f {
+			t.Errorf("%s: escolhido %s (índice %d), esperado %s", tt.name, filePath(f), i, tt.want)
+		}
+	}
+
+	// Sem nenhum vídeo no torrent
+	music := newTestTorrent(t, map[string]int64{"01.flac": 1000, "capa.jpg": 10})
+	if _, _, err := pickVideoFile(music, nil); err == nil {
+		t.Error("torrent sem vídeo não retornou erro")
+	}
+}
@@ -0,0 +1,56 @@
+package torrent
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// Formatos de segmento HLS
+const (
+	SegmentFormatTS   = "mpegts" // MPEG-TS (.ts), padrão
+	SegmentFormatFMP4 = "fmp4"   // fMP4/CMAF (init.mp4 + .m4s), necessário para HEVC/AV1
+)
+
+// Formato em uso (definido na inicialização, via SEGMENT_FORMAT)
+var segmentFormat = SegmentFormatTS
+
+// SetSegmentFormat escolhe o formato dos segmentos de vídeo
+func SetSegmentFormat(format string) error {
+	switch format {
+	case SegmentFormatTS, SegmentFormatFMP4:
+		segmentFormat = format
+		log.Printf("🎛️ Formato de segmento: %s", format)
+		return nil
+	default:
+		return fmt.Errorf("formato de segmento inválido: %q (use %s ou %s)", format, SegmentFormatTS, SegmentFormatFMP4)
+	}
+}
+
+// segmentExt retorna a extensão dos segmentos de vídeo no formato atual
+func segmentExt() string {
+	if segmentFormat == SegmentFormatFMP4 {
+		return ".m4s"
+	}
+	return ".ts"
+}
+
+// segmentPattern retorna o padrão de nome (-hls_segment_filename) dos segmentos de um diretório
+func segmentPattern(dir string) string {
+	return filepath.Join(dir, "segment%03d"+segmentExt())
+}
+
+// isVideoSegment informa se o arquivo é um segmento de mídia de vídeo (.ts ou .m4s)
+func isVideoSegment(name string) bool {
+	return strings.HasSuffix(name, ".ts") || strings.HasSuffix(name, ".m4s")
+}
+
+// initSegmentName retorna o nome do init fMP4 de uma qualidade, como gravado pelo muxer:
+// "init.mp4" no pipeline por qualidade e "init_<qualidade>.mp4" no pipeline único (-var_stream_map)
+func initSegmentName(quality string) string {
+	if transcodePipeline == PipelineSingle {
+		return "init_" + quality + ".mp4"
+	}
+	return "init.mp4"
+}
@@ -0,0 +1,65 @@
+package torrent
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSegmentFormat(t *testing.T) {
+	previousFormat, previousPipeline := segmentFormat, transcodePipeline
+	defer func() { segmentFormat, transcodePipeline = previousFormat, previousPipeline }()
+
+	tests := []struct {
+		format   string
+		pipeline string
+		ext      string
+		init     string // -hls_fmp4_init_filename ("" = sem init)
+	}{
+		{SegmentFormatTS, PipelinePerQuality, ".ts", ""},
+		{SegmentFormatTS, PipelineSingle, ".ts", ""},
+		{SegmentFormatFMP4, PipelinePerQuality, ".m4s", "init.mp4"},
+		{SegmentFormatFMP4, PipelineSingle, ".m4s", "init_720p.mp4"},
+	}
+	for _, tt := range tests {
+		if err := SetSegmentFormat(tt.format); err != nil {
+			t.Fatal(err)
+		}
+		transcodePipeline = tt.pipeline
+
+		if got := segmentExt(); got != tt.ext {
+			t.Errorf("%s: extensão %q, esperado %q", tt.format, got, tt.ext)
+		}
+		if got, want := segmentPattern("/hls/720p"), filepath.Join("/hls/720p", "segment%03d"+tt.ext); got != want {
+			t.Errorf("%s: padrão %q, esperado %q", tt.format, got, want)
+		}
+
+		args := hlsOutputArgs(&EncodingConfig{SegmentDuration: 2}, seekPoint{}, initSegmentName("720p"))
+		if got := argValue(args, "-hls_segment_type"); got != tt.format {
+			t.Errorf("%s: -hls_segment_type = %q", tt.format, got)
+		}
+		if got := argValue(args, "-hls_fmp4_init_filename"); got != tt.init {
+			t.Errorf("%s, %s: -hls_fmp4_init_filename = %q, esperado %q", tt.format, tt.pipeline, got, tt.init)
+		}
+	}
+
+	if err := SetSegmentFormat("webm"); err == nil {
+		t.Error("formato inválido aceito")
+	}
+	if segmentFormat != SegmentFormatFMP4 {
+		t.Error("formato inválido alterou o formato em uso")
+	}
+}
+
+func TestIsVideoSegment(t *testing.T) {
+	for name, want := range map[string]bool{
+		"segment000.ts":  true,
+		"segment123.m4s": true,
+		"init.mp4":       false,
+		"segment000.vtt": false,
+		"playlist.m3u8":  false,
+	} {
+		if got := isVideoSegment(name); got != want {
+			t.Errorf("isVideoSegment(%q) = %v, esperado %v", name, got, want)
+		}
+	}
+}
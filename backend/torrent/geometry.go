@@ -0,0 +1,168 @@
+package torrent
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// VideoGeometry descreve o formato dos quadros da fonte (valores do ffprobe)
+type VideoGeometry struct {
+	SAR        float64 // Proporção do pixel (1 = quadrado; 32:27 em DVD 16:9 anamórfico)
+	FieldOrder string  // progressive, tt, bb, tb, bt ou "" (desconhecido)
+}
+
+// Interlaced indica se a fonte é entrelaçada e precisa de deinterlace
+func (g VideoGeometry) Interlaced() bool {
+	switch g.FieldOrder {
+	case "tt", "bb", "tb", "bt":
+		return true
+	default:
+		return false
+	}
+}
+
+// getVideoGeometry obtém proporção do pixel e ordem dos campos do vídeo fonte
+func getVideoGeometry(videoPath string) VideoGeometry {
+	geometry := VideoGeometry{SAR: 1}
+
+	cmd := exec.Command("ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=sample_aspect_ratio,field_order",
+		"-of", "default=noprint_wrappers=1",
+		videoPath,
+	)
+	output, err := cmd.Output()
+	if err != nil {
+		log.Printf("Erro ao obter geometria do vídeo: %v", err)
+		return geometry
+	}
+
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "sample_aspect_ratio":
+			if sar := parseRatio(value, ":"); sar > 0 {
+				geometry.SAR = sar
+			}
+		case "field_order":
+			if value != "unknown" {
+				geometry.FieldOrder = value
+			}
+		}
+	}
+	return geometry
+}
+
+// parseRatio converte "num<sep>den" em número ("0:1", "N/A" e afins retornam 0)
+func parseRatio(value, sep string) float64 {
+	num, den, ok := strings.Cut(value, sep)
+	if !ok {
+		return 0
+	}
+	n, err1 := strconv.ParseFloat(num, 64)
+	d, err2 := strconv.ParseFloat(den, 64)
+	if err1 != nil || err2 != nil || n <= 0 || d <= 0 {
+		return 0
+	}
+	return n / d
+}
+
+// displayAspect é a proporção de exibição da fonte (largura x SAR / altura; 0 = desconhecida)
+func displayAspect(media mediaInfo) float64 {
+	if media.SourceWidth <= 0 || media.SourceHeight <= 0 {
+		return 0
+	}
+	sar := media.Geometry.SAR
+	if sar <= 0 {
+		sar = 1
+	}
+	return float64(media.SourceWidth) * sar / float64(media.SourceHeight)
+}
+
+// evenRound arredonda para o par mais próximo (exigência do yuv420p)
+func evenRound(x float64) int {
+	n := 2 * int(math.Round(x/2))
+	if n < 2 {
+		return 2
+	}
+	return n
+}
+
+// fitToSource ajusta as dimensões das qualidades à proporção de exibição da fonte:
+// a altura da qualidade é mantida e a largura acompanha o aspecto (par); se ela passar
+// da largura da qualidade (ex: 2.39:1), a largura é fixada e a altura reduzida.
+// O resultado é a resolução real de saída, usada no filtro e no RESOLUTION do master.
+func fitToSource(ladder []QualityLevel, media mediaInfo) []QualityLevel {
+	aspect := displayAspect(media)
+	if aspect <= 0 {
+		return ladder
+	}
+
+	fitted := make([]QualityLevel, len(ladder))
+	for i, q := range ladder {
+		fitted[i] = q
+		if q.Copy {
+			continue
+		}
+		width := evenRound(float64(q.Height) * aspect)
+		height := q.Height
+		if width > q.Width {
+			width = q.Width
+			height = evenRound(float64(q.Width) / aspect)
+		}
+		fitted[i].Width, fitted[i].Height = width, height
+	}
+	return fitted
+}
+
+// deinterlaceFilter retorna o deinterlace adequado ao decoder ("" em fonte progressiva).
+// Só os quadros marcados como entrelaçados são processados (fontes mistas, telecine).
+// Roda antes da escala, na resolução original dos campos.
+func deinterlaceFilter(encoder string, geometry VideoGeometry) string {
+	if !geometry.Interlaced() {
+		return ""
+	}
+	switch encoder {
+	case "vaapi":
+		return "format=nv12|vaapi,hwupload,deinterlace_vaapi=rate=frame"
+	case "nvenc":
+		return "yadif_cuda=mode=send_frame:deint=interlaced"
+	default:
+		return "bwdif=mode=send_frame:parity=auto:deint=interlaced"
+	}
+}
+
+// sourceFilter é a parte da cadeia que independe da qualidade (aplicada uma vez por fonte;
+// no pipeline único, antes do split)
+func sourceFilter(encoder string, media mediaInfo) string {
+	if encoder == "copy" {
+		return ""
+	}
+	// Não há tone mapping em CUDA no FFmpeg: com HDR no NVENC os quadros descem para a
+	// CPU (10-bit) logo no início e o deinterlace passa a ser o de software
+	if encoder == "nvenc" && toneMapFilter(encoder, media.Color) != "" {
+		filter := "hwdownload,format=p010le"
+		if deinterlace := deinterlaceFilter("", media.Geometry); deinterlace != "" {
+			filter += "," + deinterlace
+		}
+		return filter
+	}
+	return deinterlaceFilter(encoder, media.Geometry)
+}
+
+// String resume a geometria para os logs
+func (g VideoGeometry) String() string {
+	scan := "progressivo"
+	if g.Interlaced() {
+		scan = "entrelaçado (" + g.FieldOrder + ")"
+	}
+	return fmt.Sprintf("SAR %.3f, %s", g.SAR, scan)
+}
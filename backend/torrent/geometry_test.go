@@ -0,0 +1,77 @@
+package torrent
+
+import "testing"
+
+func TestFitToSource(t *testing.T) {
+	ladder := []QualityLevel{
+		{Name: "480p", Width: 854, Height: 480},
+		{Name: "1080p", Width: 1920, Height: 1080},
+		{Name: "original", Copy: true, Width: 720, Height: 480},
+	}
+
+	tests := []struct {
+		name  string
+		media mediaInfo
+		want  [][2]int // Largura x altura por qualidade
+	}{
+		{"16:9", mediaInfo{SourceWidth: 1920, SourceHeight: 1080, Geometry: VideoGeometry{SAR: 1}}, [][2]int{{854, 480}, {1920, 1080}, {720, 480}}},
+		{"4:3", mediaInfo{SourceWidth: 1440, SourceHeight: 1080, Geometry: VideoGeometry{SAR: 1}}, [][2]int{{640, 480}, {1440, 1080}, {720, 480}}},
+		// 2.39:1 passa da largura: largura fixa, altura reduzida
+		{"scope", mediaInfo{SourceWidth: 1920, SourceHeight: 804, Geometry: VideoGeometry{SAR: 1}}, [][2]int{{854, 358}, {1920, 804}, {720, 480}}},
+		// DVD 16:9 anamórfico: 720x480 com pixels 32:27
+		{"anamórfico", mediaInfo{SourceWidth: 720, SourceHeight: 480, Geometry: VideoGeometry{SAR: 32.0 / 27}}, [][2]int{{854, 480}, {1920, 1080}, {720, 480}}},
+		{"SAR desconhecido", mediaInfo{SourceWidth: 1440, SourceHeight: 1080}, [][2]int{{640, 480}, {1440, 1080}, {720, 480}}},
+		{"dimensões desconhecidas", mediaInfo{}, [][2]int{{854, 480}, {1920, 1080}, {720, 480}}},
+	}
+	for _, tt := range tests {
+		fitted := fitToSource(ladder, tt.media)
+		for i, q := range fitted {
+			if got := [2]int{q.Width, q.Height}; got != tt.want[i] {
+				t.Errorf("%s, %s: %dx%d, esperado %dx%d", tt.name, q.Name, got[0], got[1], tt.want[i][0], tt.want[i][1])
+			}
+		}
+	}
+	if ladder[0].Width != 854 {
+		t.Error("fitToSource alterou a escada recebida")
+	}
+}
+
+func TestParseRatio(t *testing.T) {
+	tests := []struct {
+		value string
+		sep   string
+		want  float64
+	}{
+		{"32:27", ":", 32.0 / 27},
+		{"1:1", ":", 1},
+		{"24000/1001", "/", 24000.0 / 1001},
+		{"0:1", ":", 0},
+		{"N/A", ":", 0},
+		{"16", ":", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRatio(tt.value, tt.sep); got != tt.want {
+			t.Errorf("parseRatio(%q) = %v, esperado %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestDeinterlaceFilter(t *testing.T) {
+	tests := []struct {
+		encoder    string
+		fieldOrder string
+		want       string
+	}{
+		{"", "progressive", ""},
+		{"", "", ""},
+		{"", "tt", "bwdif=mode=send_frame:parity=auto:deint=interlaced"},
+		{"qsv", "bb", "bwdif=mode=send_frame:parity=auto:deint=interlaced"},
+		{"vaapi", "tb", "format=nv12|vaapi,hwupload,deinterlace_vaapi=rate=frame"},
+		{"nvenc", "bt", "yadif_cuda=mode=send_frame:deint=interlaced"},
+	}
+	for _, tt := range tests {
+		if got := deinterlaceFilter(tt.encoder, VideoGeometry{FieldOrder: tt.fieldOrder}); got != tt.want {
+			t.Errorf("%q, %q: %q, esperado %q", tt.encoder, tt.fieldOrder, got, tt.want)
+		}
+	}
+}
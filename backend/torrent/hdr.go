@@ -0,0 +1,101 @@
+package torrent
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// Formatos HDR reconhecidos na fonte ("" = SDR)
+const (
+	HDRFormatHDR10       = "HDR10"
+	HDRFormatHLG         = "HLG"
+	HDRFormatDolbyVision = "DolbyVision"
+)
+
+// VideoColorInfo descreve a cor do stream de vídeo fonte (valores do ffprobe)
+type VideoColorInfo struct {
+	Transfer  string // color_transfer (smpte2084 = PQ, arib-std-b67 = HLG)
+	Primaries string // color_primaries (bt2020 em HDR)
+	Space     string // color_space (matriz)
+	HDRFormat string // HDR10, HLG, DolbyVision ou "" (SDR)
+	DVProfile int    // Perfil Dolby Vision (0 = sem Dolby Vision)
+}
+
+// IsHDR indica se a fonte precisa de tone mapping para virar SDR
+func (c VideoColorInfo) IsHDR() bool {
+	return c.HDRFormat != ""
+}
+
+// classifyHDR identifica o formato HDR a partir das propriedades de cor.
+// Dolby Vision tem prioridade: os perfis 7/8 carregam uma camada base HDR10/HLG.
+func classifyHDR(c VideoColorInfo) string {
+	switch {
+	case c.DVProfile > 0:
+		return HDRFormatDolbyVision
+	case c.Transfer == "smpte2084":
+		return HDRFormatHDR10
+	case c.Transfer == "arib-std-b67":
+		return HDRFormatHLG
+	default:
+		return ""
+	}
+}
+
+// VIDEO-RANGE do master playlist para a variante sem reencode
+func (c VideoColorInfo) videoRange() string {
+	switch {
+	case !c.IsHDR():
+		return "SDR"
+	case c.Transfer == "arib-std-b67":
+		return "HLG"
+	default:
+		return "PQ"
+	}
+}
+
+// Filtro zscale (libzimg) é necessário para o tone mapping por software
+var (
+	hasZscale     bool
+	hasZscaleInit sync.Once
+)
+
+func detectZscale() bool {
+	output, err := exec.Command("ffmpeg", "-hide_banner", "-filters").Output()
+	if err == nil && strings.Contains(string(output), " zscale ") {
+		return true
+	}
+	log.Println("⚠️ FFmpeg sem o filtro zscale: vídeos HDR serão convertidos sem tone mapping")
+	return false
+}
+
+// toneMapFilter retorna a cadeia que converte HDR em SDR BT.709 8-bit para o encoder
+// ("" se a fonte for SDR ou o FFmpeg não tiver suporte). Roda depois da escala,
+// então o custo cai junto com a resolução da qualidade.
+func toneMapFilter(encoder string, color VideoColorInfo) string {
+	if !color.IsHDR() {
+		return ""
+	}
+
+	// VAAPI converte na GPU, sobre as superfícies já escaladas
+	if encoder == "vaapi" {
+		return "tonemap_vaapi=format=nv12:t=bt709:m=bt709:p=bt709"
+	}
+
+	hasZscaleInit.Do(func() {
+		hasZscale = detectZscale()
+	})
+	if !hasZscale {
+		return ""
+	}
+
+	// Linearizar (PQ/HLG, BT.2020), comprimir o brilho com hable e voltar para BT.709 limitado
+	transfer := "smpte2084"
+	if color.Transfer == "arib-std-b67" {
+		transfer = "arib-std-b67"
+	}
+	return fmt.Sprintf("zscale=tin=%s:pin=bt2020:min=bt2020nc:t=linear:npl=100,format=gbrpf32le,"+
+		"zscale=p=bt709,tonemap=tonemap=hable:desat=0,zscale=t=bt709:m=bt709:r=tv,format=yuv420p", transfer)
+}
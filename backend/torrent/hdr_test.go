@@ -0,0 +1,43 @@
+package torrent
+
+import "testing"
+
+func TestClassifyHDR(t *testing.T) {
+	tests := []struct {
+		name       string
+		color      VideoColorInfo
+		format     string
+		videoRange string
+	}{
+		{"SDR BT.709", VideoColorInfo{Transfer: "bt709", Primaries: "bt709", Space: "bt709"}, "", "SDR"},
+		{"sem metadados de cor", VideoColorInfo{}, "", "SDR"},
+		{"BT.2020 sem PQ/HLG", VideoColorInfo{Transfer: "bt2020-10", Primaries: "bt2020"}, "", "SDR"},
+		{"HDR10", VideoColorInfo{Transfer: "smpte2084", Primaries: "bt2020", Space: "bt2020nc"}, HDRFormatHDR10, "PQ"},
+		{"HLG", VideoColorInfo{Transfer: "arib-std-b67", Primaries: "bt2020"}, HDRFormatHLG, "HLG"},
+		{"Dolby Vision 5", VideoColorInfo{DVProfile: 5}, HDRFormatDolbyVision, "PQ"},
+		// Perfis 7/8 carregam camada base HDR10/HLG: Dolby Vision tem prioridade
+		{"Dolby Vision 8.1", VideoColorInfo{Transfer: "smpte2084", DVProfile: 8}, HDRFormatDolbyVision, "PQ"},
+		{"Dolby Vision 8.4", VideoColorInfo{Transfer: "arib-std-b67", DVProfile: 8}, HDRFormatDolbyVision, "HLG"},
+	}
+	for _, tt := range tests {
+		color := tt.color
+		color.HDRFormat = classifyHDR(color)
+		if color.HDRFormat != tt.format {
+			t.Errorf("%s: formato %q, esperado %q", tt.name, color.HDRFormat, tt.format)
+		}
+		if got := color.videoRange(); got != tt.videoRange {
+			t.Errorf("%s: VIDEO-RANGE %q, esperado %q", tt.name, got, tt.videoRange)
+		}
+	}
+}
+
+func TestToneMapFilter(t *testing.T) {
+	hdr := VideoColorInfo{Transfer: "smpte2084", HDRFormat: HDRFormatHDR10}
+
+	if got := toneMapFilter("", VideoColorInfo{}); got != "" {
+		t.Errorf("SDR com tone mapping: %q", got)
+	}
+	if got := toneMapFilter("vaapi", hdr); got != "tonemap_vaapi=format=nv12:t=bt709:m=bt709:p=bt709" {
+		t.Errorf("VAAPI: %q", got)
+	}
+}
@@ -0,0 +1,217 @@
+package torrent
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// Modos de transcodificação
+const (
+	TranscodeEager    = "eager"     // Todas as qualidades codificadas do início ao fim (padrão)
+	TranscodeOnDemand = "on-demand" // Só o que o player pede: FFmpeg por rendition iniciado, reposicionado e encerrado sob demanda
+)
+
+// Modo em uso (definido na inicialização, via TRANSCODE_MODE)
+var transcodeMode = TranscodeEager
+
+// SetTranscodeMode escolhe quando as qualidades são transcodificadas
+func SetTranscodeMode(mode string) error {
+	switch mode {
+	case TranscodeEager, TranscodeOnDemand:
+		transcodeMode = mode
+		log.Printf("🎛️ Modo de transcodificação: %s", mode)
+		return nil
+	default:
+		return fmt.Errorf("modo de transcodificação inválido: %q (use %s ou %s)", mode, TranscodeEager, TranscodeOnDemand)
+	}
+}
+
+// Sem pedidos de segmento por esse tempo, o FFmpeg da rendition é encerrado (on-demand)
+const workerIdleTimeout = 60 * time.Second
+
+// Quantos segmentos o FFmpeg pode estar à frente do último pedido pelo player (~3min com
+// segmentos de 2s). Passando disso ele é encerrado e volta quando o player se aproximar.
+const workerMaxLeadSegments = 90
+
+// Intervalo de verificação dos FFmpeg ociosos
+const workerReapInterval = 5 * time.Second
+
+// onDemand informa se o arquivo atual é transcodificado sob demanda. Sem as playlists VOD
+// (duração desconhecida) o player só conhece os segmentos que o FFmpeg já listou e nenhum
+// pedido de segmento inicia uma rendition parada (ver SeekToSegment): vale o modo eager.
+func (s *StreamInfo) onDemand() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return transcodeMode == TranscodeOnDemand && s.vodPlaylists
+}
+
+// initialRenditions escolhe o que começa a ser transcodificado junto com o arquivo.
+// Sob demanda só a qualidade base e a faixa de áudio padrão começam sozinhas (o player
+// precisa delas para abrir); as demais esperam ser pedidas (ver RequestSegment). A variante
+// sem reencode também começa: é barata e não pode ser iniciada por um pedido de segmento.
+func initialRenditions(qualities []QualityLevel, audio []AudioRendition, onDemand bool) ([]QualityLevel, []AudioRendition) {
+	if !onDemand {
+		return qualities, audio
+	}
+	startQualities := qualities
+	if transcodePipeline != PipelineSingle && len(qualities) > 0 {
+		startQualities = []QualityLevel{qualities[0]}
+		for _, q := range qualities[1:] {
+			if q.Copy {
+				startQualities = append(startQualities, q)
+			}
+		}
+	}
+	if len(audio) > 1 {
+		audio = audio[:1]
+	}
+	return startQualities, audio
+}
+
+// RequestSegment registra o pedido de um segmento pelo player e garante que alguém vai
+// produzi-lo: segmentos já gerados são servidos do disco; para os demais o FFmpeg da
+// rendition é iniciado ou reposicionado (ver SeekToSegment).
+// Retorna true se um FFmpeg foi (ou está sendo) reposicionado para o segmento.
+func RequestSegment(stream *StreamInfo, rendition, segmentName string) bool {
+	if n, ok := parseSegmentNumber(segmentName); ok {
+		stream.mu.Lock()
+		if stream.requests == nil {
+			stream.requests = make(map[string]seekRequest)
+		}
+		stream.requests[rendition] = seekRequest{Segment: n, At: time.Now()}
+		stream.mu.Unlock()
+	}
+	return SeekToSegment(stream, rendition, segmentName)
+}
+
+// nextProducedSegment retorna o primeiro segmento já existente depois de from (-1 se não houver).
+// Um FFmpeg iniciado em from para ali: dali em diante o trecho já foi gerado.
+func nextProducedSegment(dir string, from int) int {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return -1
+	}
+	next := -1
+	for _, f := range files {
+		if num, ok := parseSegmentNumber(f.Name()); ok && num > from && (next == -1 || num < next) {
+			next = num
+		}
+	}
+	return next
+}
+
+// ffmpegWorker é um processo FFmpeg em execução e os jobs das renditions que ele gera
+// (um no pipeline por qualidade e no áudio; a escada inteira no pipeline único)
+type ffmpegWorker struct {
+	cmd  *exec.Cmd
+	jobs []*qualityJob
+}
+
+// runningWorkers agrupa os jobs ativos (inclusive na fila do scheduler) pelo processo FFmpeg
+func (s *StreamInfo) runningWorkers() []ffmpegWorker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var workers []ffmpegWorker
+	index := make(map[*exec.Cmd]int)
+	for name, job := range s.jobs {
+		cmd := s.qualityCmds[name]
+		if cmd == nil || !job.progress.active() {
+			continue
+		}
+		i, ok := index[cmd]
+		if !ok {
+			i = len(workers)
+			index[cmd] = i
+			workers = append(workers, ffmpegWorker{cmd: cmd})
+		}
+		workers[i].jobs = append(workers[i].jobs, job)
+	}
+	return workers
+}
+
+// idleReason explica por que o job não precisa mais rodar ("" = precisa)
+func (s *StreamInfo) idleReason(job *qualityJob, segmentDuration int) string {
+	// A variante sem reencode não é reiniciada por pedidos de segmento (ver SeekToSegment)
+	if q, ok := s.findQuality(job.progress.Quality); ok && q.Copy {
+		return ""
+	}
+
+	s.mu.Lock()
+	progress := job.progress
+	last, requested := s.requests[progress.Quality]
+	playerActive := len(s.requests) > 0
+	s.mu.Unlock()
+
+	// Chegou a um trecho já gerado por um FFmpeg anterior
+	if job.until > 0 {
+		dir := filepath.Join(s.hlsDir(), progress.Quality)
+		if _, err := os.Stat(filepath.Join(dir, fmt.Sprintf("segment%03d%s", job.until-1, segmentExt()))); err == nil {
+			return fmt.Sprintf("alcançou o segmento %d, já gerado", job.until)
+		}
+	}
+
+	// Antes do primeiro pedido do player (stream abrindo) nada é considerado ocioso
+	lastActivity := job.started
+	if requested && last.At.After(lastActivity) {
+		lastActivity = last.At
+	}
+	if playerActive && time.Since(lastActivity) > workerIdleTimeout {
+		return fmt.Sprintf("sem pedidos há %.0fs", time.Since(lastActivity).Seconds())
+	}
+
+	if requested {
+		produced := int(progress.OutTime) / segmentDuration
+		if produced-last.Segment > workerMaxLeadSegments {
+			return fmt.Sprintf("%d segmentos à frente do player", produced-last.Segment)
+		}
+	}
+	return ""
+}
+
+// reapIdleWorkers encerra periodicamente os FFmpeg que ninguém está usando (modo on-demand).
+// Um processo com várias renditions só é encerrado quando todas estão ociosas.
+// Os segmentos gerados ficam no disco; o próximo pedido além deles reinicia o FFmpeg.
+func reapIdleWorkers(stream *StreamInfo, done chan struct{}) {
+	ticker := time.NewTicker(workerReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		segmentDuration := stream.encodingConfig().SegmentDuration
+		for _, w := range stream.runningWorkers() {
+			reason := ""
+			for _, job := range w.jobs {
+				if reason = stream.idleReason(job, segmentDuration); reason == "" {
+					break
+				}
+			}
+			if reason == "" {
+				continue
+			}
+
+			for _, job := range w.jobs {
+				stream.updateJob(job, func(p *QualityProgress) {
+					if p.active() {
+						p.State = JobStopped
+					}
+				})
+				// O próximo pedido além do trecho gerado precisa reiniciar, mesmo perto do último seek
+				stream.mu.Lock()
+				delete(stream.seeks, job.progress.Quality)
+				stream.mu.Unlock()
+				log.Printf("[%s] 💤 %s: FFmpeg encerrado (%s)", stream.ID[:8], job.progress.Quality, reason)
+			}
+			stopFFmpeg(w.cmd)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package torrent
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInitialRenditions(t *testing.T) {
+	previousMode, previousPipeline := transcodeMode, transcodePipeline
+	defer func() { transcodeMode, transcodePipeline = previousMode, previousPipeline }()
+	transcodeMode = TranscodeOnDemand
+
+	ladder := []QualityLevel{{Name: "360p"}, {Name: "720p"}, {Name: "1080p"}, {Name: "original", Copy: true}}
+	audio := []AudioRendition{{Name: "audio0"}, {Name: "audio1"}}
+	names := func(qualities []QualityLevel) []string {
+		var result []string
+		for _, q := range qualities {
+			result = append(result, q.Name)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name      string
+		pipeline  string
+		vod       bool
+		qualities []string
+		audio     int
+	}{
+		{"sob demanda", PipelinePerQuality, true, []string{"360p", "original"}, 1},
+		{"pipeline único", PipelineSingle, true, []string{"360p", "720p", "1080p", "original"}, 1},
+		// Sem playlists VOD nada inicia uma rendition parada: todas começam
+		{"duração desconhecida", PipelinePerQuality, false, []string{"360p", "720p", "1080p", "original"}, 2},
+	}
+
+	for _, tt := range tests {
+		transcodePipeline = tt.pipeline
+		stream := newTestStream(StateTranscoding)
+		stream.vodPlaylists = tt.vod
+
+		input := append([]QualityLevel(nil), ladder...)
+		qualities, startAudio := initialRenditions(input, audio, stream.onDemand())
+		if got := names(qualities); !reflect.DeepEqual(got, tt.qualities) {
+			t.Errorf("%s: qualidades iniciadas = %v, esperado %v", tt.name, got, tt.qualities)
+		}
+		if len(startAudio) != tt.audio {
+			t.Errorf("%s: %d faixas de áudio iniciadas, esperado %d", tt.name, len(startAudio), tt.audio)
+		}
+		if !reflect.DeepEqual(input, ladder) {
+			t.Errorf("%s: escada alterada para %v", tt.name, names(input))
+		}
+	}
+}
+
+func TestIdleReason(t *testing.T) {
+	hlsDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(hlsDir, "720p"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Trecho já gerado a partir do segmento 50 por um FFmpeg anterior
+	if err := os.WriteFile(filepath.Join(hlsDir, "720p", "segment049.ts"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-workerIdleTimeout - time.Second)
+	tests := []struct {
+		name     string
+		quality  string
+		until    int
+		outTime  float64
+		started  time.Time
+		requests map[string]seekRequest
+		idle     string // Trecho esperado do motivo ("" = precisa rodar)
+	}{
+		{"stream abrindo, sem pedidos", "720p", -1, 0, old, nil, ""},
+		{"pedido recente", "720p", -1, 20, old, map[string]seekRequest{"720p": {Segment: 5, At: time.Now()}}, ""},
+		{"sem pedidos da rendition", "720p", -1, 20, old, map[string]seekRequest{"360p": {Segment: 5, At: time.Now()}}, "sem pedidos"},
+		{"pedido antigo", "720p", -1, 20, old, map[string]seekRequest{"720p": {Segment: 5, At: old}}, "sem pedidos"},
+		{"iniciado há pouco, sem pedidos", "720p", -1, 0, time.Now(), map[string]seekRequest{"360p": {At: old}}, ""},
+		{"à frente do player", "720p", -1, 200, old, map[string]seekRequest{"720p": {Segment: 5, At: time.Now()}}, "segmentos à frente"},
+		{"alcançou trecho gerado", "720p", 50, 100, time.Now(), nil, "alcançou o segmento 50"},
+		{"trecho seguinte ainda não gerado", "720p", 80, 100, time.Now(), nil, ""},
+		{"variante sem reencode nunca é encerrada", "original", -1, 20, old, map[string]seekRequest{"360p": {At: old}}, ""},
+	}
+	for _, tt := range tests {
+		stream := newTestStream(StateTranscoding)
+		stream.hlsPath = hlsDir
+		stream.ladder = []QualityLevel{{Name: "360p"}, {Name: "720p"}, {Name: "original", Copy: true}}
+		job := stream.startJob(tt.quality, 0, tt.until)
+		job.started = tt.started
+		job.progress.OutTime = tt.outTime
+		stream.requests = tt.requests
+
+		reason := stream.idleReason(job, 2)
+		if (tt.idle == "") != (reason == "") || !strings.Contains(reason, tt.idle) {
+			t.Errorf("%s: motivo %q, esperado %q", tt.name, reason, tt.idle)
+		}
+	}
+}
+
+func TestNextProducedSegment(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"segment003.ts", "segment010.ts", "segment007.ts", "playlist.m3u8", "init.mp4"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for from, want := range map[int]int{0: 3, 3: 7, 5: 7, 7: 10, 10: -1} {
+		if got := nextProducedSegment(dir, from); got != want {
+			t.Errorf("nextProducedSegment(%d) = %d, esperado %d", from, got, want)
+		}
+	}
+	if got := nextProducedSegment(filepath.Join(dir, "inexistente"), 0); got != -1 {
+		t.Errorf("diretório inexistente: %d, esperado -1", got)
+	}
+}
@@ -0,0 +1,175 @@
+package torrent
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Pipelines de transcodificação da escada ABR
+const (
+	PipelinePerQuality = "per-quality" // Um FFmpeg por qualidade (padrão)
+	PipelineSingle     = "single"      // Um FFmpeg decodifica a fonte uma vez e gera todas as qualidades
+)
+
+// Pipeline em uso (definido na inicialização, via TRANSCODE_PIPELINE)
+var transcodePipeline = PipelinePerQuality
+
+// SetTranscodePipeline escolhe o pipeline de transcodificação
+func SetTranscodePipeline(mode string) error {
+	switch mode {
+	case PipelinePerQuality, PipelineSingle:
+		transcodePipeline = mode
+		log.Printf("🎛️ Pipeline de transcodificação: %s", mode)
+		return nil
+	default:
+		return fmt.Errorf("pipeline de transcodificação inválido: %q (use %s ou %s)", mode, PipelinePerQuality, PipelineSingle)
+	}
+}
+
+// encodedRungs retorna as qualidades reencodadas da escada. A variante sem reencode fica
+// fora do FFmpeg único: ela não decodifica a fonte e tem processo próprio, que nunca é
+// reposicionado (um reinício da escada reescreveria a playlist dela sem o histórico).
+func encodedRungs(ladder []QualityLevel) []QualityLevel {
+	var encoded []QualityLevel
+	for _, q := range ladder {
+		if !q.Copy {
+			encoded = append(encoded, q)
+		}
+	}
+	return encoded
+}
+
+// buildLadderArgs constrói um único comando FFmpeg para toda a escada.
+// O vídeo é decodificado uma vez e dividido com split e o muxer HLS separa as
+// variantes com -var_stream_map
+// (o diretório de cada variante é o nome da qualidade, como no pipeline por qualidade).
+func buildLadderArgs(cfg *EncodingConfig, media mediaInfo, ladder []QualityLevel, hlsDir string, seek seekPoint) []string {
+	// Garantir que hwAccel foi detectado
+	hwAccelInit.Do(func() {
+		hwAccel = detectHardwareAcceleration()
+	})
+
+	args := ffmpegInputArgs(media.VideoFile, hwAccel, seek)
+
+	// Uma ramificação do split por qualidade reencodada (o remux usa o stream da fonte direto)
+	var encoded []int
+	for i, q := range ladder {
+		if !q.Copy {
+			encoded = append(encoded, i)
+		}
+	}
+	// O que independe da qualidade (deinterlace) roda uma vez, antes do split
+	if len(encoded) > 0 {
+		var graph strings.Builder
+		graph.WriteString("[0:v:0]")
+		if filter := sourceFilter(hwAccel, media); filter != "" {
+			graph.WriteString(filter + ",")
+		}
+		fmt.Fprintf(&graph, "split=%d", len(encoded))
+		for _, i := range encoded {
+			fmt.Fprintf(&graph, "[s%d]", i)
+		}
+		for _, i := range encoded {
+			fmt.Fprintf(&graph, ";[s%d]%s[v%d]", i, qualityFilter(hwAccel, ladder[i], media), i)
+		}
+		args = append(args, "-filter_complex", graph.String())
+	}
+
+	// Só vídeo: as faixas de áudio têm playlists próprias, geradas uma vez (ver audio.go)
+	variants := make([]string, len(ladder))
+	for i, q := range ladder {
+		encoder := hwAccel
+		if q.Copy {
+			encoder = "copy"
+			args = append(args, "-map", "0:v:0")
+		} else {
+			args = append(args, "-map", fmt.Sprintf("[v%d]", i))
+		}
+		args = append(args, videoCodecArgs(cfg, encoder, q, media.FrameRate, fmt.Sprintf("v:%d", i))...)
+		variants[i] = fmt.Sprintf("v:%d,name:%s", i, q.Name)
+	}
+
+	// Com várias variantes o init precisa de %v no nome (senão o muxer usa o índice da variante)
+	args = append(args, hlsOutputArgs(cfg, seek, "init_%v.mp4")...)
+	args = append(args,
+		"-var_stream_map", strings.Join(variants, " "),
+		"-hls_segment_filename", segmentPattern(filepath.Join(hlsDir, "%v")),
+		"-f", "hls",
+		filepath.Join(hlsDir, "%v", encoderPlaylistName),
+	)
+
+	// O master playlist continua sendo o de generateMasterPlaylist: ele é escrito antes do
+	// primeiro segmento e já declara legendas e faixas de áudio (-master_pl_name não é usado).
+	return args
+}
+
+// transcodeLadder inicia o FFmpeg único que gera todas as qualidades a partir de seek
+func transcodeLadder(stream *StreamInfo, ladder []QualityLevel, seek seekPoint) error {
+	hlsDir := stream.hlsDir()
+	for _, q := range ladder {
+		if err := os.MkdirAll(filepath.Join(hlsDir, q.Name), 0755); err != nil {
+			return err
+		}
+	}
+
+	media := stream.currentMedia()
+	args := buildLadderArgs(stream.encodingConfig(), media, ladder, hlsDir, seek)
+
+	log.Printf("[%s] Iniciando transcodificação da escada em um único FFmpeg (%d qualidades, a partir de %.0fs)...",
+		stream.ID[:8], len(ladder), seek.Time)
+
+	names := make([]string, len(ladder))
+	for i, q := range ladder {
+		names[i] = q.Name
+	}
+	_, err := runFFmpegJob(stream, names, args, hlsDir, seek.Time)
+	return err
+}
+
+// waitLadderQuality aguarda o primeiro segmento de uma qualidade do FFmpeg único.
+// Em caso de timeout só a qualidade é marcada como falha: o processo segue gerando as demais.
+func waitLadderQuality(stream *StreamInfo, quality QualityLevel, done chan struct{}) error {
+	err := waitFirstSegment(stream, quality, filepath.Join(stream.hlsDir(), quality.Name), done)
+	if err == errSegmentTimeout {
+		stream.mu.Lock()
+		job := stream.jobs[quality.Name]
+		stream.mu.Unlock()
+		if job != nil {
+			stream.failJob(job, err.Error())
+		}
+	}
+	return err
+}
+
+// restartLadderAt substitui o FFmpeg único por um novo começando em seek (todas as qualidades
+// reencodadas). Renditions de áudio e a variante sem reencode têm processos próprios e não são afetadas.
+func restartLadderAt(stream *StreamInfo, seek seekPoint) error {
+	stream.mu.Lock()
+	ladder := encodedRungs(stream.ladder)
+	var cmds []*exec.Cmd
+	seen := make(map[*exec.Cmd]bool)
+	for _, q := range ladder {
+		cmd := stream.qualityCmds[q.Name]
+		if cmd != nil && !seen[cmd] {
+			cmds = append(cmds, cmd)
+			seen[cmd] = true
+		}
+	}
+	stream.mu.Unlock()
+
+	// Fora da trava do stream: um job ainda na fila notifica as renditions ao sair dela
+	for _, cmd := range cmds {
+		stopFFmpeg(cmd)
+	}
+
+	if err := transcodeLadder(stream, ladder, seek); err != nil {
+		return err
+	}
+
+	log.Printf("[%s] Escada: FFmpeg reiniciado em %.0fs (segmento %d)", stream.ID[:8], seek.Time, seek.Segment)
+	return nil
+}
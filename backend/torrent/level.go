@@ -0,0 +1,68 @@
+package torrent
+
+import (
+	"fmt"
+	"math"
+)
+
+// Perfil H.264 das qualidades reencodadas: nome passado ao encoder e profile_idc com as
+// flags de restrição do CODECS (Main com constraint_set1, como o libx264 grava)
+const (
+	encodedH264Profile       = "main"
+	encodedH264ProfileCodecs = "4d40"
+)
+
+// h264Level são os limites de um nível H.264 (Tabela A-1): macroblocos por segundo,
+// macroblocos por quadro e bitrate máximo do perfil Main (kbps)
+type h264Level struct {
+	IDC     int // level_idc (ex: 42 = 4.2)
+	MaxMBPS int
+	MaxFS   int
+	MaxBR   int
+}
+
+// Níveis usados nas qualidades reencodadas. O menor é o 4.0 que a escada sempre usou;
+// acima dele o nível sobe com a resolução, o frame rate e o maxrate da qualidade.
+var h264Levels = []h264Level{
+	{40, 245760, 8192, 20000},
+	{41, 245760, 8192, 50000},
+	{42, 522240, 8704, 50000},
+	{50, 589824, 22080, 135000},
+	{51, 983040, 36864, 240000},
+	{52, 2073600, 36864, 240000},
+}
+
+// encodedLevel retorna o menor nível H.264 que comporta a qualidade reencodada.
+// frameRate é o da fonte (0 = desconhecido, assume defaultFrameRate como o GOP).
+func encodedLevel(quality QualityLevel, frameRate float64) int {
+	if frameRate <= 0 {
+		frameRate = defaultFrameRate
+	}
+	frameMBs := int(math.Ceil(float64(quality.Width)/16) * math.Ceil(float64(quality.Height)/16))
+	mbps := int(math.Ceil(float64(frameMBs) * frameRate))
+	bitrate := parseKbps(quality.MaxBitrate)
+
+	for _, l := range h264Levels {
+		if frameMBs <= l.MaxFS && mbps <= l.MaxMBPS && bitrate <= l.MaxBR {
+			return l.IDC
+		}
+	}
+	return h264Levels[len(h264Levels)-1].IDC
+}
+
+// levelName formata o level_idc como os encoders aceitam (40 -> "4", 42 -> "4.2")
+func levelName(idc int) string {
+	if idc%10 == 0 {
+		return fmt.Sprintf("%d", idc/10)
+	}
+	return fmt.Sprintf("%d.%d", idc/10, idc%10)
+}
+
+// videoCodecs retorna o CODECS (RFC 6381) do vídeo de uma qualidade, o mesmo no master
+// playlist e no MPD: o da fonte na variante sem reencode, ou perfil e nível do encoder
+func videoCodecs(quality QualityLevel, frameRate float64) string {
+	if quality.Copy {
+		return quality.Codecs
+	}
+	return fmt.Sprintf("avc1.%s%02x", encodedH264ProfileCodecs, encodedLevel(quality, frameRate))
+}
@@ -0,0 +1,39 @@
+package torrent
+
+import "testing"
+
+func TestVideoCodecsLevel(t *testing.T) {
+	tests := []struct {
+		quality   QualityLevel
+		frameRate float64
+		codecs    string
+		level     string
+	}{
+		{QualityLevel{Name: "360p", Width: 640, Height: 360, MaxBitrate: "856k"}, 29.97, "avc1.4d4028", "4"},
+		{QualityLevel{Name: "1080p", Width: 1920, Height: 1080, MaxBitrate: "5350k"}, 30, "avc1.4d4028", "4"},
+		{QualityLevel{Name: "1080p", Width: 1920, Height: 1080, MaxBitrate: "5350k"}, 59.94, "avc1.4d402a", "4.2"},
+		{QualityLevel{Name: "1080p", Width: 1920, Height: 1080, MaxBitrate: "25000k"}, 24, "avc1.4d4029", "4.1"},
+		{QualityLevel{Name: "2160p", Width: 3840, Height: 2160, MaxBitrate: "16000k"}, 24, "avc1.4d4033", "5.1"},
+		{QualityLevel{Name: "2160p", Width: 3840, Height: 2160, MaxBitrate: "16000k"}, 60, "avc1.4d4034", "5.2"},
+		// Frame rate desconhecido: defaultFrameRate
+		{QualityLevel{Name: "1080p", Width: 1920, Height: 1080, MaxBitrate: "5350k"}, 0, "avc1.4d4028", "4"},
+	}
+
+	cfg := &EncodingConfig{SegmentDuration: 2}
+	for _, tt := range tests {
+		if got := videoCodecs(tt.quality, tt.frameRate); got != tt.codecs {
+			t.Errorf("%s a %.2ffps: CODECS = %q, esperado %q", tt.quality.Name, tt.frameRate, got, tt.codecs)
+		}
+		// O encoder grava o nível anunciado
+		args := videoCodecArgs(cfg, "", tt.quality, tt.frameRate, "v")
+		if got := argValue(args, "-level:v"); got != tt.level {
+			t.Errorf("%s a %.2ffps: -level:v = %q, esperado %q", tt.quality.Name, tt.frameRate, got, tt.level)
+		}
+	}
+
+	// A variante sem reencode anuncia o perfil e o nível da fonte
+	original := QualityLevel{Name: "original", Copy: true, Codecs: "avc1.640029"}
+	if got := videoCodecs(original, 60); got != original.Codecs {
+		t.Errorf("remux: CODECS = %q, esperado %q", got, original.Codecs)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package torrent
+
+import "errors"
+
+// Sem sinais POSIX: jobs especulativos esperam vaga em vez de serem pausados
+const canPauseProcesses = false
+
+var errPauseUnsupported = errors.New("pausar processos não é suportado nesta plataforma")
+
+func setProcessNice(pid, nice int) {}
+
+func pauseProcess(pid int) error {
+	return errPauseUnsupported
+}
+
+func resumeProcess(pid int) error {
+	return errPauseUnsupported
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package torrent
+
+import "syscall"
+
+// Pausar e retomar processos (SIGSTOP/SIGCONT) está disponível
+const canPauseProcesses = true
+
+// setProcessNice ajusta a prioridade de CPU de um processo (erros são ignorados: sem
+// permissão para reduzir o nice o processo só continua com a prioridade anterior)
+func setProcessNice(pid, nice int) {
+	syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice)
+}
+
+// pauseProcess suspende um processo até resumeProcess
+func pauseProcess(pid int) error {
+	return syscall.Kill(pid, syscall.SIGSTOP)
+}
+
+// resumeProcess retoma um processo suspenso por pauseProcess
+func resumeProcess(pid int) error {
+	return syscall.Kill(pid, syscall.SIGCONT)
+}
@@ -0,0 +1,300 @@
+package torrent
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Estados de um job FFmpeg de qualidade
+const (
+	JobQueued   = "queued"  // Aguardando vaga no scheduler
+	JobPaused   = "paused"  // Suspenso pelo scheduler para dar vaga a um job em reprodução
+	JobWaiting  = "waiting" // Terminou antes do fim do vídeo; aguardando peças para retomar
+	JobRunning  = "running"
+	JobFinished = "finished"
+	JobFailed   = "failed"
+	JobStopped  = "stopped" // Encerrado por ociosidade (modo on-demand) ou removido da fila antes de rodar
+)
+
+// QualityProgress é o progresso real da transcodificação de uma qualidade,
+// lido da saída -progress do FFmpeg
+type QualityProgress struct {
+	Quality  string  `json:"quality"`
+	State    string  `json:"state"`    // queued, running, paused, waiting, finished, failed ou stopped
+	Start    float64 `json:"start"`    // Posição (s) em que o job começou (seek)
+	OutTime  float64 `json:"outTime"`  // Posição (s) já codificada no vídeo
+	Speed    float64 `json:"speed"`    // Multiplicador do tempo real (1.0 = tempo real)
+	Segments int     `json:"segments"` // Segmentos disponíveis no diretório da qualidade
+	Error    string  `json:"error,omitempty"`
+}
+
+// qualityJob identifica uma execução do FFmpeg de uma qualidade.
+// Um seek substitui o job; atualizações do job antigo são ignoradas.
+type qualityJob struct {
+	progress   QualityProgress
+	started    time.Time
+	until      int       // Primeiro segmento já existente à frente do início (-1 = nenhum)
+	advancedAt time.Time // Último avanço da saída (detecção de travamento, protegido por s.mu)
+}
+
+// startJob registra um novo job para a qualidade, substituindo o anterior
+func (s *StreamInfo) startJob(quality string, start float64, until int) *qualityJob {
+	job := &qualityJob{
+		progress:   QualityProgress{Quality: quality, State: JobQueued, Start: start, OutTime: start},
+		started:    time.Now(),
+		until:      until,
+		advancedAt: time.Now(),
+	}
+
+	s.mu.Lock()
+	if s.jobs == nil {
+		s.jobs = make(map[string]*qualityJob)
+	}
+	s.jobs[quality] = job
+	s.mu.Unlock()
+
+	return job
+}
+
+// updateJob altera o progresso de um job se ele ainda for o atual da qualidade
+func (s *StreamInfo) updateJob(job *qualityJob, update func(p *QualityProgress)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.jobs[job.progress.Quality] != job {
+		return
+	}
+	update(&job.progress)
+
+	// Qualidade com segmentos passa a constar na lista de disponíveis (renditions de áudio não)
+	if job.progress.Segments > 0 && s.inLadderLocked(job.progress.Quality) && !containsString(s.qualities, job.progress.Quality) {
+		s.qualities = append(s.qualities, job.progress.Quality)
+	}
+}
+
+// jobWaiting informa se o job atual da rendition está aguardando o scheduler (fila ou pausa)
+// ou o supervisor (peças para retomar)
+func (s *StreamInfo) jobWaiting(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[name]
+	return ok && (job.progress.State == JobQueued || job.progress.State == JobPaused || job.progress.State == JobWaiting)
+}
+
+// active informa se o job ainda vai produzir segmentos (na fila, rodando, pausado ou aguardando retomada)
+func (p QualityProgress) active() bool {
+	return p.State == JobQueued || p.State == JobRunning || p.State == JobPaused || p.State == JobWaiting
+}
+
+// failJob marca o job como falho (a primeira causa é mantida)
+func (s *StreamInfo) failJob(job *qualityJob, reason string) {
+	s.updateJob(job, func(p *QualityProgress) {
+		if p.active() {
+			p.State = JobFailed
+			p.Error = reason
+		}
+	})
+}
+
+// qualityProgressLocked lista o progresso na ordem da escada, seguido das renditions de áudio (requer s.mu)
+func (s *StreamInfo) qualityProgressLocked() []QualityProgress {
+	result := make([]QualityProgress, 0, len(s.ladder)+len(s.audioRenditions))
+	for _, q := range s.ladder {
+		if job, ok := s.jobs[q.Name]; ok {
+			result = append(result, job.progress)
+		}
+	}
+	for _, r := range s.audioRenditions {
+		if job, ok := s.jobs[r.Name]; ok {
+			result = append(result, job.progress)
+		}
+	}
+	return result
+}
+
+// inLadderLocked informa se o nome é uma qualidade de vídeo da escada (requer s.mu)
+func (s *StreamInfo) inLadderLocked(name string) bool {
+	for _, q := range s.ladder {
+		if q.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// watchProgress lê a saída "-progress pipe:1" do FFmpeg (blocos chave=valor terminados
+// em progress=continue|end) e atualiza os jobs do processo a cada bloco
+func watchProgress(stream *StreamInfo, jobs []*qualityJob, r io.Reader, hlsDir string) {
+	var outTime, speed float64
+	hasTime := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "out_time_us":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+				outTime = float64(us) / 1e6
+				hasTime = true
+			}
+		case "speed":
+			if x, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "x"), 64); err == nil {
+				speed = x
+			}
+		case "progress":
+			for _, job := range jobs {
+				segments := countSegmentsInDir(filepath.Join(hlsDir, job.progress.Quality))
+				stream.updateJob(job, func(p *QualityProgress) {
+					if hasTime {
+						if p.Start+outTime > p.OutTime {
+							job.advancedAt = time.Now()
+						}
+						p.OutTime = p.Start + outTime
+					}
+					p.Speed = speed
+					p.Segments = segments
+				})
+			}
+		}
+	}
+}
+
+// runFFmpegJob coloca no scheduler um FFmpeg que gera as renditions dadas (qualidades ou
+// áudio), acompanhando o progresso. O processo começa quando houver vaga; ao terminar,
+// os jobs são marcados como finished ou failed.
+func runFFmpegJob(stream *StreamInfo, names []string, args []string, hlsDir string, start float64) ([]*qualityJob, error) {
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stderr = os.Stderr // Log de erros do FFmpeg
+
+	// Adicionar à lista de processos do stream (o mesmo processo pode servir várias qualidades)
+	for _, name := range names {
+		stream.trackQualityCmd(name, cmd)
+	}
+
+	startSegment := int(start) / stream.encodingConfig().SegmentDuration
+	jobs := make([]*qualityJob, len(names))
+	for i, name := range names {
+		jobs[i] = stream.startJob(name, start, nextProducedSegment(filepath.Join(hlsDir, name), startSegment))
+	}
+
+	// A retomada pertence ao arquivo em que o job começou (troca de arquivo ou stop a cancelam)
+	stream.mu.Lock()
+	fileDone := stream.fileDone
+	stream.mu.Unlock()
+
+	kind := TaskVideo
+	if _, ok := stream.findAudioRendition(names[0]); ok {
+		kind = TaskAudio
+	}
+	label := strings.Join(names, ",")
+
+	launch := func() error {
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+
+		go func() {
+			// A saída precisa ser lida por completo antes do Wait
+			watchProgress(stream, jobs, stdout, hlsDir)
+			err := cmd.Wait()
+			scheduler.release(cmd)
+
+			duration := stream.currentMedia().Duration
+			segmentDuration := stream.encodingConfig().SegmentDuration
+			canResume := resumable(stream, names)
+			downloaded := stream.fileDownloaded()
+			premature := false
+			for _, job := range jobs {
+				segments := countSegmentsInDir(filepath.Join(hlsDir, job.progress.Quality))
+				stream.updateJob(job, func(p *QualityProgress) {
+					p.Segments = segments
+					if !p.active() {
+						return
+					}
+					// Parou antes do fim (buraco no arquivo parcial, travamento): o supervisor retoma
+					// (a variante original não é retomada: ver resumable)
+					if canResume && endedEarly(duration, p.OutTime, segmentDuration, err == nil, downloaded) {
+						p.State = JobWaiting
+						premature = true
+						return
+					}
+					if err != nil {
+						p.State = JobFailed
+						p.Error = err.Error()
+					} else {
+						p.State = JobFinished
+					}
+				})
+			}
+
+			if premature {
+				log.Printf("[%s] %s: FFmpeg terminou antes do fim do vídeo (%v), retomando", stream.ID[:8], label, err)
+				go resumeJob(stream, names, jobs, hlsDir, start, fileDone)
+			} else if err != nil {
+				log.Printf("[%s] %s: FFmpeg terminou com erro: %v", stream.ID[:8], label, err)
+			} else {
+				log.Printf("[%s] %s: transcodificação a partir de %.0fs completa", stream.ID[:8], label, start)
+			}
+		}()
+		return nil
+	}
+
+	scheduler.submit(&ffmpegTask{
+		stream: stream,
+		names:  names,
+		kind:   kind,
+		cmd:    cmd,
+		launch: launch,
+		onState: func(state string) {
+			for _, job := range jobs {
+				stream.updateJob(job, func(p *QualityProgress) {
+					if p.active() {
+						p.State = state
+						job.advancedAt = time.Now() // Tempo na fila ou pausado não conta como travamento
+					}
+				})
+			}
+		},
+		onError: func(err error) {
+			log.Printf("[%s] %s: erro ao iniciar FFmpeg: %v", stream.ID[:8], label, err)
+			for _, job := range jobs {
+				stream.failJob(job, err.Error())
+			}
+		},
+	})
+
+	return jobs, nil
+}
+
+// runQualityJob inicia o FFmpeg de uma única qualidade (pipeline por qualidade)
+func runQualityJob(stream *StreamInfo, quality QualityLevel, args []string, start float64) (*qualityJob, error) {
+	jobs, err := runFFmpegJob(stream, []string{quality.Name}, args, stream.hlsDir(), start)
+	if err != nil {
+		return nil, err
+	}
+	return jobs[0], nil
+}
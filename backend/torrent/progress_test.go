@@ -0,0 +1,95 @@
+package torrent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWatchProgress(t *testing.T) {
+	hlsDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(hlsDir, "360p"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"segment005.ts", "segment006.ts", "playlist.m3u8"} {
+		if err := os.WriteFile(filepath.Join(hlsDir, "360p", name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		output  string
+		outTime float64
+		speed   float64
+	}{
+		{
+			"blocos completos",
+			"frame=10\nout_time_us=1500000\nspeed=2.5x\nprogress=continue\nout_time_us=3500000\nspeed= 3.1x\nprogress=end\n",
+			13.5, 3.1,
+		},
+		{
+			// O FFmpeg informa tempo negativo e N/A antes do primeiro quadro
+			"início sem tempo",
+			"out_time_us=-9223372036854775807\nspeed=N/A\nprogress=continue\n",
+			10, 0,
+		},
+		{
+			"bloco sem progress não é aplicado",
+			"out_time_us=4000000\nspeed=1x\n",
+			10, 0,
+		},
+		{"linhas inválidas", "lixo\nout_time_us=abc\n\nprogress=continue\n", 10, 0},
+	}
+	for _, tt := range tests {
+		stream := newTestStream(StateTranscoding)
+		stream.ladder = []QualityLevel{{Name: "360p"}}
+		job := stream.startJob("360p", 10, -1)
+
+		watchProgress(stream, []*qualityJob{job}, strings.NewReader(tt.output), hlsDir)
+
+		progress := stream.qualityProgressLocked()[0]
+		if progress.OutTime != tt.outTime || progress.Speed != tt.speed {
+			t.Errorf("%s: outTime %.1f, speed %.1f; esperado %.1f, %.1f", tt.name, progress.OutTime, progress.Speed, tt.outTime, tt.speed)
+		}
+	}
+}
+
+func TestUpdateJobIgnoresReplacedJob(t *testing.T) {
+	stream := newTestStream(StateTranscoding)
+	stream.ladder = []QualityLevel{{Name: "360p"}}
+	old := stream.startJob("360p", 0, -1)
+	current := stream.startJob("360p", 60, -1) // Seek: o job anterior deixa de valer
+
+	stream.updateJob(old, func(p *QualityProgress) { p.OutTime = 30 })
+	stream.failJob(old, "morto pelo seek")
+	stream.updateJob(current, func(p *QualityProgress) { p.State = JobRunning; p.Segments = 1 })
+
+	progress := stream.qualityProgressLocked()
+	if len(progress) != 1 || progress[0].Start != 60 || progress[0].OutTime != 60 || progress[0].State != JobRunning {
+		t.Fatalf("progresso = %+v", progress)
+	}
+	if snap := stream.Snapshot(); !containsString(snap.Qualities, "360p") {
+		t.Error("qualidade com segmentos não entrou nas disponíveis")
+	}
+
+	// A primeira causa de falha é mantida
+	stream.failJob(current, "primeira")
+	stream.failJob(current, "segunda")
+	if p := stream.qualityProgressLocked()[0]; p.State != JobFailed || p.Error != "primeira" {
+		t.Errorf("falha = %s %q, esperado failed \"primeira\"", p.State, p.Error)
+	}
+}
+
+func TestQualityProgressActive(t *testing.T) {
+	active := map[string]bool{
+		JobQueued: true, JobRunning: true, JobPaused: true, JobWaiting: true,
+		JobFinished: false, JobFailed: false, JobStopped: false,
+	}
+	for state, want := range active {
+		if got := (QualityProgress{State: state}).active(); got != want {
+			t.Errorf("%s: active = %v, esperado %v", state, got, want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package torrent
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+)
+
+// Codecs que o navegador reproduz direto via HLS/MSE (sem reencodar).
+// O áudio AAC é copiado nas renditions de áudio (ver stereoRenditions).
+var (
+	remuxVideoCodecs = map[string]bool{"h264": true}
+	remuxAudioCodecs = map[string]bool{"aac": true}
+)
+
+// Perfis H.264 que os navegadores decodificam: profile_idc e flags de restrição do CODECS
+// (High 10, 4:2:2 e 4:4:4 ficam de fora)
+var remuxH264Profiles = map[string]string{
+	"Constrained Baseline": "42E0",
+	"Baseline":             "4200",
+	"Main":                 "4D00",
+	"High":                 "6400",
+}
+
+// Formatos de pixel aceitos no remux: 8-bit 4:2:0
+var remuxPixelFormats = map[string]bool{"yuv420p": true, "yuvj420p": true}
+
+// h264Format descreve o stream H.264 da fonte (valores do ffprobe)
+type h264Format struct {
+	Profile string // ex: "High", "High 10"
+	Level   int    // ex: 41 (= 4.1)
+	PixFmt  string // ex: "yuv420p"
+}
+
+// remuxCodecs monta o CODECS (avc1.PPCCLL) da fonte, ou false se o navegador não a decodifica
+func remuxCodecs(f h264Format) (string, bool) {
+	profile, ok := remuxH264Profiles[f.Profile]
+	if !ok || !remuxPixelFormats[f.PixFmt] || f.Level <= 0 || f.Level > 0xff {
+		return "", false
+	}
+	return fmt.Sprintf("avc1.%s%02X", profile, f.Level), true
+}
+
+// getH264Format obtém perfil, nível e formato de pixel do vídeo usando ffprobe
+func getH264Format(videoPath string) h264Format {
+	cmd := exec.Command("ffprobe",
+		"-v", "error",
+		"-select_streams", "v:0",
+		"-show_entries", "stream=profile,level,pix_fmt",
+		"-of", "default=noprint_wrappers=1",
+		videoPath,
+	)
+
+	var f h264Format
+	output, err := cmd.Output()
+	if err != nil {
+		log.Printf("Erro ao obter perfil do vídeo: %v", err)
+		return f
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "profile":
+			f.Profile = value
+		case "level":
+			fmt.Sscanf(value, "%d", &f.Level)
+		case "pix_fmt":
+			f.PixFmt = value
+		}
+	}
+	return f
+}
+
+// remuxVariant monta a variante "original" (stream copy) quando o vídeo fonte já é
+// compatível com o navegador. Como as demais qualidades, ela leva só o vídeo.
+func remuxVariant(stream *StreamInfo, videoCodec string) (QualityLevel, bool) {
+	if !remuxVideoCodecs[videoCodec] {
+		return QualityLevel{}, false
+	}
+
+	media := stream.currentMedia()
+
+	// H.264 não basta: o perfil e o formato de pixel precisam ser decodificáveis no navegador
+	format := getH264Format(media.VideoFile)
+	codecs, ok := remuxCodecs(format)
+	if !ok {
+		log.Printf("[%s] Fonte %s (%s, nível %d, %s) não é reproduzível no navegador, sem variante original",
+			stream.ID[:8], videoCodec, format.Profile, format.Level, format.PixFmt)
+		return QualityLevel{}, false
+	}
+
+	// Bitrate médio do arquivo, usado como BANDWIDTH no master playlist
+	bitrate := "20000k"
+	stream.mu.Lock()
+	t := stream.torrent
+	stream.mu.Unlock()
+	if media.Duration > 0 && t != nil && media.FileIndex >= 0 {
+		fileSize := t.Files()[media.FileIndex].Length()
+		bitrate = fmt.Sprintf("%dk", int64(float64(fileSize)*8/media.Duration/1000))
+	}
+
+	log.Printf("[%s] 🎯 Fonte compatível (%s %s), adicionando variante original por remux", stream.ID[:8], videoCodec, codecs)
+
+	return QualityLevel{
+		Name:    "original",
+		Width:   media.SourceWidth,
+		Height:  media.SourceHeight,
+		Bitrate: bitrate,
+		Copy:    true,
+		Codecs:  codecs,
+	}, true
+}
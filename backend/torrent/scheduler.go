@@ -0,0 +1,496 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Prioridades dos jobs FFmpeg no scheduler
+const (
+	PriorityPlaying     = "playing"     // Rendition que um espectador está assistindo (ou abrindo)
+	PrioritySpeculative = "speculative" // Gerada antecipadamente: demais qualidades, legendas, miniaturas
+)
+
+// Tipos de job FFmpeg
+const (
+	TaskVideo      = "video"
+	TaskAudio      = "audio"
+	TaskSubtitle   = "subtitle"
+	TaskThumbnails = "thumbnails"
+)
+
+// Jobs especulativos rodam com prioridade de CPU menor (nice)
+const speculativeNice = 10
+
+// Uma rendition pedida pelo player nesse intervalo é considerada em reprodução
+const playingWindow = 30 * time.Second
+
+// Menor orçamento aceito: a qualidade base e a faixa de áudio padrão são ambas playing e
+// um job playing não pausa outro, então com uma vaga só o player nunca abriria
+const minFFmpegJobs = 2
+
+// Intervalo de reavaliação das prioridades
+const schedulerInterval = 2 * time.Second
+
+// errTaskCanceled indica um job removido da fila antes de começar
+var errTaskCanceled = errors.New("cancelado antes de iniciar")
+
+// ffmpegTask é um processo FFmpeg sob controle do scheduler
+type ffmpegTask struct {
+	id       int
+	stream   *StreamInfo
+	names    []string // Renditions geradas pelo processo
+	kind     string
+	cmd      *exec.Cmd
+	launch   func() error       // Inicia o processo (chamado quando há vaga)
+	onState  func(state string) // Notifica queued -> running <-> paused, ou stopped se sair da fila
+	onError  func(err error)    // O processo não pôde ser iniciado
+	started  chan struct{}      // Fechado ao iniciar (ou ao sair da fila)
+	err      error
+	state    string // JobQueued, JobRunning ou JobPaused
+	priority string
+	nice     int
+	pid      int  // Preenchido depois do start (0 = não iniciado)
+	canceled bool // stopFFmpeg chegou depois de o plano iniciar o job, antes do pid existir
+	queuedAt time.Time
+	startAt  time.Time
+}
+
+// ffmpegScheduler controla todos os FFmpeg de longa duração do servidor: um processo só
+// roda quando há vaga no orçamento; jobs playing passam na frente da fila e podem pausar
+// (SIGSTOP) jobs especulativos para ocupar a vaga deles
+type ffmpegScheduler struct {
+	mu      sync.Mutex
+	applyMu sync.Mutex // Um reschedule por vez: sinais chegam na ordem em que foram planejados
+	maxJobs int        // Processos rodando ao mesmo tempo (0 = sem limite)
+	tasks   []*ffmpegTask
+	nextID  int
+	loop    sync.Once
+}
+
+var scheduler = &ffmpegScheduler{maxJobs: max(runtime.NumCPU(), minFFmpegJobs)}
+
+// SetMaxFFmpegJobs define quantos processos FFmpeg podem rodar ao mesmo tempo (0 = sem limite).
+// Valores abaixo de minFFmpegJobs são elevados a ele.
+func SetMaxFFmpegJobs(n int) error {
+	if n < 0 {
+		return fmt.Errorf("limite de processos FFmpeg inválido: %d", n)
+	}
+	if n > 0 && n < minFFmpegJobs {
+		log.Printf("⚠️ Processos FFmpeg: limite %d elevado para %d (vídeo e áudio em reprodução rodam juntos)", n, minFFmpegJobs)
+		n = minFFmpegJobs
+	}
+	scheduler.mu.Lock()
+	scheduler.maxJobs = n
+	scheduler.mu.Unlock()
+
+	if n == 0 {
+		log.Println("🎛️ Processos FFmpeg: sem limite")
+	} else {
+		log.Printf("🎛️ Processos FFmpeg: até %d simultâneos", n)
+	}
+	scheduler.reschedule()
+	return nil
+}
+
+// submit coloca o processo na fila; ele é iniciado assim que houver vaga
+func (sc *ffmpegScheduler) submit(t *ffmpegTask) {
+	sc.loop.Do(func() {
+		go sc.run()
+	})
+
+	t.priority = t.stream.taskPriority(t.kind, t.names)
+	t.started = make(chan struct{})
+
+	sc.mu.Lock()
+	sc.nextID++
+	t.id = sc.nextID
+	t.state = JobQueued
+	t.queuedAt = time.Now()
+	sc.tasks = append(sc.tasks, t)
+	sc.mu.Unlock()
+
+	sc.reschedule()
+}
+
+// release remove um processo que terminou e libera a vaga dele
+func (sc *ffmpegScheduler) release(cmd *exec.Cmd) {
+	sc.mu.Lock()
+	sc.removeLocked(cmd)
+	sc.mu.Unlock()
+	sc.reschedule()
+}
+
+// cancel encerra um processo que ainda não começou (true se ele não chegou a rodar ou
+// vai ser morto assim que o launch terminar). Com false, o processo já tem pid (ou nunca
+// foi aceito) e cmd.Process pode ser lido sem disputar com o cmd.Start do launch.
+func (sc *ffmpegScheduler) cancel(cmd *exec.Cmd) bool {
+	sc.mu.Lock()
+	t := sc.findLocked(cmd)
+	if t == nil || (t.state != JobQueued && t.pid != 0) {
+		sc.mu.Unlock()
+		return false
+	}
+	if t.state != JobQueued {
+		// Já escolhido pelo plano, mas o launch ainda não terminou: reschedule encerra
+		t.canceled = true
+		sc.mu.Unlock()
+		return true
+	}
+	sc.removeLocked(cmd)
+	sc.mu.Unlock()
+
+	t.dropped()
+	return true
+}
+
+// dropped encerra um job que saiu do scheduler sem rodar: quem espera o início recebe
+// errTaskCanceled e as renditions deixam de constar como na fila
+func (t *ffmpegTask) dropped() {
+	t.err = errTaskCanceled
+	close(t.started)
+	if t.onState != nil {
+		t.onState(JobStopped)
+	}
+}
+
+func (sc *ffmpegScheduler) findLocked(cmd *exec.Cmd) *ffmpegTask {
+	for _, t := range sc.tasks {
+		if t.cmd == cmd {
+			return t
+		}
+	}
+	return nil
+}
+
+func (sc *ffmpegScheduler) removeLocked(cmd *exec.Cmd) {
+	for i, t := range sc.tasks {
+		if t.cmd == cmd {
+			sc.tasks = append(sc.tasks[:i], sc.tasks[i+1:]...)
+			return
+		}
+	}
+}
+
+// run reavalia periodicamente as prioridades (o que o player está pedindo muda com o tempo)
+func (sc *ffmpegScheduler) run() {
+	ticker := time.NewTicker(schedulerInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		sc.mu.Lock()
+		tasks := append([]*ffmpegTask(nil), sc.tasks...)
+		sc.mu.Unlock()
+
+		// As prioridades consultam o stream: calculadas fora do lock do scheduler
+		priorities := make([]string, len(tasks))
+		for i, t := range tasks {
+			priorities[i] = t.stream.taskPriority(t.kind, t.names)
+		}
+
+		sc.mu.Lock()
+		for i, t := range tasks {
+			t.priority = priorities[i]
+		}
+		sc.mu.Unlock()
+
+		sc.reschedule()
+	}
+}
+
+// Ações decididas por plan e executadas fora do lock
+const (
+	actionStart  = "start"
+	actionPause  = "pause"
+	actionResume = "resume"
+	actionNice   = "nice"
+)
+
+type schedulerAction struct {
+	task *ffmpegTask
+	op   string
+	pid  int // Copiados do job no plano (pause, resume e nice)
+	nice int
+}
+
+// reschedule aplica o plano atual: inicia, pausa, retoma e ajusta a prioridade de CPU.
+// Planejar e aplicar acontecem sob applyMu: com dois planos aplicados ao mesmo tempo, um
+// SIGSTOP de um deles poderia chegar depois do SIGCONT do outro e congelar um job "running".
+func (sc *ffmpegScheduler) reschedule() {
+	for sc.applyPlan() {
+	}
+}
+
+// applyPlan executa um plano; true se uma vaga reservada não foi usada e vale replanejar
+func (sc *ffmpegScheduler) applyPlan() bool {
+	sc.applyMu.Lock()
+	defer sc.applyMu.Unlock()
+
+	sc.mu.Lock()
+	actions := sc.planLocked()
+	sc.mu.Unlock()
+
+	again := false
+	for _, a := range actions {
+		t := a.task
+		switch a.op {
+		case actionStart:
+			sc.mu.Lock()
+			canceled := t.canceled
+			if canceled {
+				sc.removeLocked(t.cmd)
+			}
+			sc.mu.Unlock()
+			if canceled {
+				t.dropped()
+				again = true
+				continue
+			}
+
+			if err := t.launch(); err != nil {
+				sc.mu.Lock()
+				sc.removeLocked(t.cmd)
+				sc.mu.Unlock()
+				t.err = err
+				close(t.started)
+				if t.onError != nil {
+					t.onError(err)
+				}
+				again = true
+				continue
+			}
+			sc.mu.Lock()
+			t.pid = t.cmd.Process.Pid
+			nice := t.nice
+			canceled = t.canceled
+			sc.mu.Unlock()
+			if canceled {
+				// stopFFmpeg chegou durante o launch: o Wait do processo libera a vaga
+				t.cmd.Process.Kill()
+				close(t.started)
+				continue
+			}
+			if nice != 0 {
+				setProcessNice(t.pid, nice)
+			}
+			close(t.started)
+			if t.onState != nil {
+				t.onState(JobRunning)
+			}
+		case actionPause:
+			if err := pauseProcess(a.pid); err != nil {
+				log.Printf("⚠️ Erro ao pausar FFmpeg %d: %v", t.id, err)
+			}
+			log.Printf("[%s] ⏸️ %v: FFmpeg pausado para dar vaga a um job em reprodução", t.stream.ID[:8], t.names)
+			if t.onState != nil {
+				t.onState(JobPaused)
+			}
+		case actionResume:
+			setProcessNice(a.pid, a.nice)
+			if err := resumeProcess(a.pid); err != nil {
+				log.Printf("⚠️ Erro ao retomar FFmpeg %d: %v", t.id, err)
+			}
+			if t.onState != nil {
+				t.onState(JobRunning)
+			}
+		case actionNice:
+			setProcessNice(a.pid, a.nice)
+		}
+	}
+	return again
+}
+
+// planLocked decide o que muda: jobs playing antes dos especulativos, pausados antes dos
+// que nunca rodaram e, dentro disso, pela ordem de chegada (requer sc.mu)
+func (sc *ffmpegScheduler) planLocked() []schedulerAction {
+	var actions []schedulerAction
+
+	running := 0
+	var waiting []*ffmpegTask
+	for _, t := range sc.tasks {
+		switch t.state {
+		case JobRunning:
+			running++
+		case JobQueued, JobPaused:
+			waiting = append(waiting, t)
+		}
+	}
+	sort.SliceStable(waiting, func(i, j int) bool {
+		a, b := waiting[i], waiting[j]
+		if (a.priority == PriorityPlaying) != (b.priority == PriorityPlaying) {
+			return a.priority == PriorityPlaying
+		}
+		if (a.state == JobPaused) != (b.state == JobPaused) {
+			return a.state == JobPaused
+		}
+		return a.id < b.id
+	})
+
+	wake := func(t *ffmpegTask) {
+		op := actionResume
+		if t.state == JobQueued {
+			op = actionStart
+			t.startAt = time.Now()
+		}
+		t.state = JobRunning
+		t.nice = niceFor(t.priority)
+		actions = append(actions, schedulerAction{task: t, op: op, pid: t.pid, nice: t.nice})
+		running++
+	}
+
+	for _, t := range waiting {
+		if sc.maxJobs == 0 || running < sc.maxJobs {
+			wake(t)
+			continue
+		}
+		if t.priority != PriorityPlaying || !canPauseProcesses {
+			continue
+		}
+		// Sem vaga: pausar o especulativo mais recente em execução
+		var victim *ffmpegTask
+		for _, r := range sc.tasks {
+			if r.state == JobRunning && r.priority != PriorityPlaying && r.pid != 0 && (victim == nil || r.id > victim.id) {
+				victim = r
+			}
+		}
+		if victim == nil {
+			continue
+		}
+		victim.state = JobPaused
+		running--
+		actions = append(actions, schedulerAction{task: victim, op: actionPause, pid: victim.pid})
+		wake(t)
+	}
+
+	// Prioridade de CPU acompanha a prioridade do job
+	for _, t := range sc.tasks {
+		if t.state == JobRunning && t.pid != 0 && t.nice != niceFor(t.priority) {
+			t.nice = niceFor(t.priority)
+			actions = append(actions, schedulerAction{task: t, op: actionNice, pid: t.pid, nice: t.nice})
+		}
+	}
+	return actions
+}
+
+func niceFor(priority string) int {
+	if priority == PriorityPlaying {
+		return 0
+	}
+	return speculativeNice
+}
+
+// taskPriority define a prioridade de um processo pelo que o player está pedindo.
+// Antes do primeiro pedido (stream abrindo) a qualidade base e a faixa de áudio padrão
+// são as que o player vai pedir primeiro.
+func (s *StreamInfo) taskPriority(kind string, names []string) string {
+	if kind == TaskSubtitle || kind == TaskThumbnails {
+		return PrioritySpeculative
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.requests) == 0 {
+		for _, name := range names {
+			if (len(s.ladder) > 0 && name == s.ladder[0].Name) ||
+				(len(s.audioRenditions) > 0 && name == s.audioRenditions[0].Name) {
+				return PriorityPlaying
+			}
+		}
+		return PrioritySpeculative
+	}
+	for _, name := range names {
+		if r, ok := s.requests[name]; ok && time.Since(r.At) < playingWindow {
+			return PriorityPlaying
+		}
+	}
+	return PrioritySpeculative
+}
+
+// runScheduled executa um FFmpeg curto (legendas, miniaturas) quando houver vaga e espera terminar
+func runScheduled(stream *StreamInfo, kind string, names []string, cmd *exec.Cmd) error {
+	t := &ffmpegTask{stream: stream, names: names, kind: kind, cmd: cmd, launch: cmd.Start}
+	scheduler.submit(t)
+
+	<-t.started
+	if t.err != nil {
+		return t.err
+	}
+	err := cmd.Wait()
+	scheduler.release(cmd)
+	return err
+}
+
+// stopFFmpeg encerra um processo FFmpeg do stream, esteja ele na fila, iniciando, rodando ou pausado
+func stopFFmpeg(cmd *exec.Cmd) {
+	if cmd == nil || scheduler.cancel(cmd) {
+		return
+	}
+	if cmd.Process != nil {
+		cmd.Process.Kill()
+	}
+}
+
+// FFmpegJobInfo descreve um processo no scheduler (endpoint de administração)
+type FFmpegJobInfo struct {
+	ID         int        `json:"id"`
+	Stream     string     `json:"stream"` // Prefixo do ID, como nos logs
+	Renditions []string   `json:"renditions"`
+	Kind       string     `json:"kind"`     // video, audio, subtitle ou thumbnails
+	Priority   string     `json:"priority"` // playing ou speculative
+	State      string     `json:"state"`    // queued, running ou paused
+	Nice       int        `json:"nice"`
+	PID        int        `json:"pid,omitempty"`
+	QueuedAt   time.Time  `json:"queuedAt"`
+	StartedAt  *time.Time `json:"startedAt,omitempty"`
+}
+
+// FFmpegQueueStatus é o estado do scheduler: orçamento, ocupação e todos os processos
+type FFmpegQueueStatus struct {
+	MaxJobs int             `json:"maxJobs"` // 0 = sem limite
+	Running int             `json:"running"`
+	Paused  int             `json:"paused"`
+	Queued  int             `json:"queued"`
+	Jobs    []FFmpegJobInfo `json:"jobs"`
+}
+
+// FFmpegQueue retorna o estado atual do scheduler
+func FFmpegQueue() FFmpegQueueStatus {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	status := FFmpegQueueStatus{MaxJobs: scheduler.maxJobs, Jobs: make([]FFmpegJobInfo, 0, len(scheduler.tasks))}
+	for _, t := range scheduler.tasks {
+		info := FFmpegJobInfo{
+			ID:         t.id,
+			Stream:     t.stream.ID[:8],
+			Renditions: t.names,
+			Kind:       t.kind,
+			Priority:   t.priority,
+			State:      t.state,
+			Nice:       t.nice,
+			QueuedAt:   t.queuedAt,
+		}
+		if t.state != JobQueued {
+			startAt := t.startAt
+			info.StartedAt = &startAt
+			info.PID = t.pid
+		}
+		switch t.state {
+		case JobRunning:
+			status.Running++
+		case JobPaused:
+			status.Paused++
+		case JobQueued:
+			status.Queued++
+		}
+		status.Jobs = append(status.Jobs, info)
+	}
+	return status
+}
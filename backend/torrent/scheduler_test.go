@@ -0,0 +1,183 @@
+package torrent
+
+import (
+	"fmt"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// newSleepCmd cria um processo que só termina se for morto
+func newSleepCmd(t *testing.T) *exec.Cmd {
+	t.Helper()
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep não encontrado")
+	}
+	return exec.Command("sleep", "30")
+}
+
+func TestStopFFmpegDuringLaunch(t *testing.T) {
+	cmd := newSleepCmd(t)
+	entered := make(chan struct{})
+	gate := make(chan struct{})
+	task := &ffmpegTask{
+		stream: newTestStream(StateTranscoding),
+		names:  []string{"360p"},
+		kind:   TaskSubtitle,
+		cmd:    cmd,
+		launch: func() error {
+			close(entered)
+			<-gate
+			return cmd.Start()
+		},
+	}
+	go scheduler.submit(task)
+
+	// O plano já marcou o job como running, mas o processo ainda não existe
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("launch não foi chamado")
+	}
+	stopFFmpeg(cmd)
+	close(gate)
+
+	<-task.started
+	waited := make(chan error, 1)
+	go func() { waited <- cmd.Wait() }()
+	select {
+	case err := <-waited:
+		if err == nil {
+			t.Error("processo cancelado durante o launch terminou sem erro")
+		}
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("processo cancelado durante o launch continuou rodando")
+	}
+	scheduler.release(cmd)
+}
+
+func TestStopFFmpegQueued(t *testing.T) {
+	scheduler.mu.Lock()
+	maxJobs := scheduler.maxJobs
+	scheduler.mu.Unlock()
+	if err := SetMaxFFmpegJobs(1); err != nil {
+		t.Fatal(err)
+	}
+	defer SetMaxFFmpegJobs(maxJobs)
+
+	// O orçamento mínimo é minFFmpegJobs: ocupa todas as vagas
+	stream := newTestStream(StateTranscoding)
+	for i := 0; i < minFFmpegJobs; i++ {
+		blocker := newSleepCmd(t)
+		running := &ffmpegTask{stream: stream, names: []string{fmt.Sprintf("sub%d", i)}, kind: TaskSubtitle, cmd: blocker, launch: blocker.Start}
+		scheduler.submit(running)
+		<-running.started
+		defer func() {
+			stopFFmpeg(blocker)
+			blocker.Wait()
+			scheduler.release(blocker)
+		}()
+	}
+
+	cmd := newSleepCmd(t)
+	var states []string
+	queued := &ffmpegTask{
+		stream:  stream,
+		names:   []string{"720p"},
+		kind:    TaskSubtitle,
+		cmd:     cmd,
+		launch:  cmd.Start,
+		onState: func(state string) { states = append(states, state) },
+	}
+	scheduler.submit(queued)
+	if len(states) != 0 {
+		t.Fatalf("job sem vaga mudou de estado: %v", states)
+	}
+
+	stopFFmpeg(cmd)
+	<-queued.started
+	if queued.err != errTaskCanceled {
+		t.Errorf("err = %v, esperado %v", queued.err, errTaskCanceled)
+	}
+	if len(states) != 1 || states[0] != JobStopped {
+		t.Errorf("estados notificados = %v, esperado [%s]", states, JobStopped)
+	}
+	if cmd.Process != nil {
+		t.Error("processo removido da fila foi iniciado")
+	}
+	for _, job := range FFmpegQueue().Jobs {
+		if job.Renditions[0] == "720p" {
+			t.Errorf("job removido continua no scheduler (%s)", job.State)
+		}
+	}
+}
+
+func TestFFmpegBudgetMinimum(t *testing.T) {
+	scheduler.mu.Lock()
+	maxJobs := scheduler.maxJobs
+	scheduler.mu.Unlock()
+	defer SetMaxFFmpegJobs(maxJobs)
+
+	tests := []struct {
+		budget int
+		want   int
+	}{
+		{0, 0},
+		{1, minFFmpegJobs},
+		{minFFmpegJobs, minFFmpegJobs},
+		{8, 8},
+	}
+	for _, tt := range tests {
+		if err := SetMaxFFmpegJobs(tt.budget); err != nil {
+			t.Fatal(err)
+		}
+		if got := FFmpegQueue().MaxJobs; got != tt.want {
+			t.Errorf("SetMaxFFmpegJobs(%d): MaxJobs = %d, esperado %d", tt.budget, got, tt.want)
+		}
+	}
+	if err := SetMaxFFmpegJobs(-1); err == nil {
+		t.Error("orçamento negativo aceito")
+	}
+}
+
+func TestFFmpegBudgetOneStartsVideoAndAudio(t *testing.T) {
+	scheduler.mu.Lock()
+	maxJobs := scheduler.maxJobs
+	scheduler.mu.Unlock()
+	if err := SetMaxFFmpegJobs(1); err != nil {
+		t.Fatal(err)
+	}
+	defer SetMaxFFmpegJobs(maxJobs)
+
+	// Stream abrindo: a qualidade base e o áudio padrão são ambos playing
+	stream := newTestStream(StateTranscoding)
+	stream.ladder = []QualityLevel{{Name: "360p"}}
+	stream.audioRenditions = []AudioRendition{{Name: "audio0"}}
+
+	var tasks []*ffmpegTask
+	for _, job := range []struct{ kind, name string }{{TaskVideo, "360p"}, {TaskAudio, "audio0"}} {
+		cmd := newSleepCmd(t)
+		task := &ffmpegTask{stream: stream, names: []string{job.name}, kind: job.kind, cmd: cmd, launch: cmd.Start}
+		scheduler.submit(task)
+		tasks = append(tasks, task)
+		defer func() {
+			stopFFmpeg(cmd)
+			if cmd.Process != nil {
+				cmd.Wait()
+			}
+			scheduler.release(cmd)
+		}()
+	}
+
+	for _, task := range tasks {
+		select {
+		case <-task.started:
+			if task.err != nil {
+				t.Fatalf("%s: %v", task.names[0], task.err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s não iniciou com FFMPEG_MAX_JOBS=1", task.names[0])
+		}
+	}
+}
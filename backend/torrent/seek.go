@@ -0,0 +1,311 @@
+package torrent
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Quantos segmentos à frente do último produzido ainda são tratados como reprodução linear.
+// Pedidos além disso são considerados seek (~30s com segmentos de 2s).
+const seekThresholdSegments = 15
+
+// Margem antes do offset estimado, para cobrir o keyframe anterior e variações de bitrate
+const seekMarginBytes = 8 * 1024 * 1024
+
+// Quanto precisa estar baixado a partir do offset antes de reiniciar o FFmpeg
+const seekReadyBytes = 12 * 1024 * 1024
+
+// seekPoint é a posição de início de um job FFmpeg (zero = início do arquivo)
+type seekPoint struct {
+	Time    float64 // Posição em segundos
+	Segment int     // Número do primeiro segmento gerado
+	Restart bool    // Reinício de um job: a numeração recomeça em Segment, mesmo que seja 0
+}
+
+// seekRequest registra o último seek disparado para uma qualidade
+type seekRequest struct {
+	Segment int
+	At      time.Time
+}
+
+// readaheadOffset retorna o offset atual da janela de prioridade
+func (s *StreamInfo) readaheadOffset() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readahead
+}
+
+// trackQualityCmd registra o processo FFmpeg de uma qualidade
+func (s *StreamInfo) trackQualityCmd(quality string, cmd *exec.Cmd) {
+	s.trackFFmpeg(cmd)
+
+	s.mu.Lock()
+	if s.qualityCmds == nil {
+		s.qualityCmds = make(map[string]*exec.Cmd)
+	}
+	s.qualityCmds[quality] = cmd
+	s.mu.Unlock()
+}
+
+// killQualityCmd encerra o processo FFmpeg atual de uma qualidade
+func (s *StreamInfo) killQualityCmd(quality string) {
+	s.mu.Lock()
+	cmd := s.qualityCmds[quality]
+	s.mu.Unlock()
+	stopFFmpeg(cmd)
+}
+
+// encodingConfig retorna a configuração de codificação do arquivo atual
+// (a vigente, se a transcodificação ainda não começou)
+func (s *StreamInfo) encodingConfig() *EncodingConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.encoding != nil {
+		return s.encoding
+	}
+	return currentEncodingConfig()
+}
+
+// currentLadder retorna a escada de qualidades do arquivo atual
+func (s *StreamInfo) currentLadder() []QualityLevel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ladder
+}
+
+// findQuality busca uma qualidade na escada do arquivo atual
+func (s *StreamInfo) findQuality(name string) (QualityLevel, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, q := range s.ladder {
+		if q.Name == name {
+			return q, true
+		}
+	}
+	return QualityLevel{}, false
+}
+
+// HasRendition informa se o nome é uma qualidade, rendition de áudio, legenda ou as miniaturas do arquivo atual
+func (s *StreamInfo) HasRendition(name string) bool {
+	if _, ok := s.findQuality(name); ok {
+		return true
+	}
+	if _, ok := s.findAudioRendition(name); ok {
+		return true
+	}
+	if name == thumbnailRendition && s.currentThumbnails() != nil {
+		return true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, track := range s.media.SubtitleTracks {
+		if track.Rendition == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseSegmentNumber extrai o número de um nome como "segment042.ts" ou "segment042.m4s"
+func parseSegmentNumber(name string) (int, bool) {
+	if !strings.HasPrefix(name, "segment") || !isVideoSegment(name) {
+		return 0, false
+	}
+	var n int
+	if _, err := fmt.Sscanf(strings.TrimSuffix(strings.TrimPrefix(name, "segment"), filepath.Ext(name)), "%d", &n); err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// lastSegmentBefore retorna o maior segmento existente com número <= n, ou -1
+func lastSegmentBefore(dir string, n int) int {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return -1
+	}
+	last := -1
+	for _, f := range files {
+		if num, ok := parseSegmentNumber(f.Name()); ok && num <= n && num > last {
+			last = num
+		}
+	}
+	return last
+}
+
+// jobCovers informa se o job atual da rendition chegará em breve à posição t: está ativo,
+// começou em ou antes dela e está a no máximo horizon segundos de distância.
+// Sem job, a rendition ainda está iniciando (eager) ou nunca foi pedida (on-demand).
+func (s *StreamInfo) jobCovers(name string, t, horizon float64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[name]
+	if !ok {
+		return transcodeMode != TranscodeOnDemand
+	}
+	p := job.progress
+	return p.active() && p.Start <= t && t-p.OutTime <= horizon
+}
+
+// SeekToSegment trata o pedido de um segmento ainda não gerado.
+// Se ele estiver muito à frente do que a qualidade (ou rendition de áudio) já produziu,
+// move a janela de prioridade do torrent para a posição correspondente e reinicia o
+// FFmpeg dela a partir dali. Retorna true se há um seek em andamento para o segmento.
+func SeekToSegment(stream *StreamInfo, qualityName, segmentName string) bool {
+	n, ok := parseSegmentNumber(segmentName)
+	if !ok {
+		return false
+	}
+
+	// Cada tipo de rendition tem seu próprio reinício
+	var restart func(seek seekPoint, done chan struct{}) error
+	if quality, ok := stream.findQuality(qualityName); ok {
+		// O remux corta nos keyframes da fonte (o segmento n não começa em n*segment_duration)
+		// e o player lê a playlist do próprio FFmpeg: ele só avança linearmente, sem seek
+		if quality.Copy {
+			return false
+		}
+		restart = func(seek seekPoint, done chan struct{}) error {
+			return restartQualityAt(stream, quality, seek, done)
+		}
+	} else if audio, ok := stream.findAudioRendition(qualityName); ok {
+		restart = func(seek seekPoint, done chan struct{}) error {
+			return restartAudioAt(stream, audio, seek, done)
+		}
+	}
+
+	media := stream.currentMedia()
+	hlsDir := stream.hlsDir()
+	if restart == nil || media.Duration <= 0 || hlsDir == "" {
+		return false
+	}
+
+	qualityDir := filepath.Join(hlsDir, qualityName)
+	if _, err := os.Stat(filepath.Join(qualityDir, segmentName)); err == nil {
+		return false
+	}
+
+	segmentDuration := stream.encodingConfig().SegmentDuration
+	seekTime := float64(n * segmentDuration)
+
+	// Reprodução linear: o FFmpeg atual chegará ao segmento em breve.
+	// Com a playlist VOD completa o player pode pedir trechos que nenhum job vai gerar
+	// (antes do início do job atual, longe dele ou depois que ele terminou): esses também reiniciam.
+	prev := lastSegmentBefore(qualityDir, n)
+	if n-prev <= seekThresholdSegments && stream.jobCovers(qualityName, seekTime, float64(seekThresholdSegments*segmentDuration)) {
+		return false
+	}
+
+	if seekTime >= media.Duration {
+		return false
+	}
+
+	stream.mu.Lock()
+	t := stream.torrent
+	fileIndex := stream.media.FileIndex
+	done := stream.fileDone
+	if last, ok := stream.seeks[qualityName]; ok &&
+		n >= last.Segment && n-last.Segment <= seekThresholdSegments && time.Since(last.At) < 2*time.Minute {
+		// Já existe um seek recente cobrindo este segmento
+		stream.mu.Unlock()
+		return true
+	}
+	if stream.seeks == nil {
+		stream.seeks = make(map[string]seekRequest)
+	}
+	stream.seeks[qualityName] = seekRequest{Segment: n, At: time.Now()}
+	stream.mu.Unlock()
+
+	if t == nil || t.Info() == nil || fileIndex < 0 || done == nil {
+		return false
+	}
+
+	videoFile := t.Files()[fileIndex]
+	pieceLength := int64(t.Info().PieceLength)
+	fileLength := videoFile.Length()
+
+	// Mapear tempo -> byte pela taxa média do arquivo (MKV/MP4 parciais raramente têm o índice disponível)
+	byteOffset := int64(float64(fileLength)*(seekTime/media.Duration)) - seekMarginBytes
+	if byteOffset < 0 {
+		byteOffset = 0
+	}
+
+	stream.mu.Lock()
+	stream.readahead = byteOffset
+	stream.mu.Unlock()
+
+	lastPieceIndex := int((videoFile.Offset() + fileLength - 1) / pieceLength)
+	startPiece := int((videoFile.Offset() + byteOffset) / pieceLength)
+	prioritizeWindow(t, startPiece, lastPieceIndex, pieceLength)
+
+	log.Printf("[%s] ⏩ Seek %s: segmento %d (%.0fs) -> offset %.2f MB",
+		stream.ID[:8], qualityName, n, seekTime, float64(byteOffset)/1024/1024)
+
+	readyPiece := int((videoFile.Offset() + byteOffset + seekReadyBytes) / pieceLength)
+	if readyPiece > lastPieceIndex {
+		readyPiece = lastPieceIndex
+	}
+
+	go func() {
+		// Aguardar os dados da nova posição para o FFmpeg não ler "buracos" do arquivo
+		deadline := time.Now().Add(2 * time.Minute)
+		for firstIncompletePiece(t, startPiece, readyPiece) != -1 {
+			if time.Now().After(deadline) {
+				log.Printf("[%s] ⚠️ Seek %s: timeout aguardando peças, reiniciando assim mesmo", stream.ID[:8], qualityName)
+				break
+			}
+			select {
+			case <-done:
+				return
+			case <-time.After(500 * time.Millisecond):
+			}
+		}
+
+		if err := restart(seekPoint{Time: seekTime, Segment: n, Restart: true}, done); err != nil {
+			log.Printf("[%s] ⚠️ Seek %s: erro ao reiniciar FFmpeg: %v", stream.ID[:8], qualityName, err)
+		}
+	}()
+
+	return true
+}
+
+// restartQualityAt substitui o FFmpeg de uma qualidade por um novo começando em seek
+func restartQualityAt(stream *StreamInfo, quality QualityLevel, seek seekPoint, done chan struct{}) error {
+	select {
+	case <-done:
+		return fmt.Errorf("cancelado")
+	default:
+	}
+
+	if quality.Copy {
+		return fmt.Errorf("a variante %s não pode ser reposicionada", quality.Name)
+	}
+
+	// No pipeline único todas as qualidades reencodadas saem do mesmo processo: reiniciar a escada inteira
+	if transcodePipeline == PipelineSingle {
+		return restartLadderAt(stream, seek)
+	}
+
+	stream.killQualityCmd(quality.Name)
+
+	media := stream.currentMedia()
+	qualityDir := filepath.Join(stream.hlsDir(), quality.Name)
+	playlistPath := filepath.Join(qualityDir, encoderPlaylistName)
+	segmentPath := segmentPattern(qualityDir)
+
+	args := buildFFmpegArgs(stream.encodingConfig(), media, quality, playlistPath, segmentPath, seek)
+
+	if _, err := runQualityJob(stream, quality, args, seek.Time); err != nil {
+		return fmt.Errorf("erro ao iniciar FFmpeg: %v", err)
+	}
+
+	log.Printf("[%s] %s: FFmpeg reiniciado em %.0fs (segmento %d)", stream.ID[:8], quality.Name, seek.Time, seek.Segment)
+
+	return nil
+}
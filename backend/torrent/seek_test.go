@@ -0,0 +1,31 @@
+package torrent
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHLSOutputArgsRestart(t *testing.T) {
+	cfg := &EncodingConfig{SegmentDuration: 2}
+
+	tests := []struct {
+		name        string
+		seek        seekPoint
+		startNumber string
+		appendList  bool
+	}{
+		{"início", seekPoint{}, "", true},
+		{"reinício no segmento 0", seekPoint{Segment: 0, Restart: true}, "0", false},
+		{"reinício no meio", seekPoint{Time: 20, Segment: 10, Restart: true}, "10", false},
+	}
+
+	for _, tt := range tests {
+		args := hlsOutputArgs(cfg, tt.seek, "init.mp4")
+		if got := argValue(args, "-start_number"); got != tt.startNumber {
+			t.Errorf("%s: -start_number = %q, esperado %q", tt.name, got, tt.startNumber)
+		}
+		if got := strings.Contains(argValue(args, "-hls_flags"), "append_list"); got != tt.appendList {
+			t.Errorf("%s: append_list = %v, esperado %v", tt.name, got, tt.appendList)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package torrent
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/torrent"
+)
+
+// Extensões de legenda externa que o FFmpeg converte para WebVTT
+// (.sub fica de fora: costuma ser VobSub, que é imagem)
+var sidecarSubtitleExtensions = []string{".srt", ".ass", ".ssa", ".vtt"}
+
+// Nomes comuns de pastas de legendas em releases
+var subtitleDirNames = map[string]bool{"subs": true, "sub": true, "subtitles": true, "legendas": true}
+
+// Sufixos de idioma encontrados em nomes de legenda -> código usado em getLanguageName
+var subtitleLanguageAliases = map[string]string{
+	"pt": "por", "pt-br": "por", "ptbr": "por", "pob": "por", "por": "por", "portuguese": "por", "portugues": "por", "português": "por", "brazilian": "por",
+	"en": "eng", "eng": "eng", "english": "eng",
+	"es": "spa", "es-419": "spa", "spa": "spa", "spanish": "spa", "espanol": "spa", "español": "spa",
+	"fr": "fre", "fre": "fre", "fra": "fre", "french": "fre",
+	"de": "ger", "ger": "ger", "deu": "ger", "german": "ger",
+	"it": "ita", "ita": "ita", "italian": "ita",
+	"ja": "jpn", "jpn": "jpn", "japanese": "jpn",
+	"ru": "rus", "rus": "rus", "russian": "rus",
+	"ko": "kor", "kor": "kor", "korean": "kor",
+	"zh": "chi", "chi": "chi", "zho": "chi", "chinese": "chi",
+	"ar": "ara", "ara": "ara", "arabic": "ara",
+	"hi": "hin", "hin": "hin", "hindi": "hin",
+}
+
+func isSidecarSubtitle(p string) bool {
+	ext := strings.ToLower(path.Ext(p))
+	for _, e := range sidecarSubtitleExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// findSidecarSubtitles encontra legendas externas que pertencem ao vídeo escolhido:
+//   - mesma pasta e mesmo nome base (Filme.srt, Filme.pt-BR.srt, Filme.eng.forced.srt)
+//   - Subs/<nome do vídeo>/*.srt (comum em packs de temporada)
+//   - Subs/*.srt, apenas quando o torrent tem um único vídeo ou o nome bate
+func findSidecarSubtitles(t *torrent.Torrent, video *torrent.File) []*torrent.File {
+	videoDir := path.Dir(video.Path())
+	videoBase := strings.TrimSuffix(path.Base(video.Path()), path.Ext(video.Path()))
+
+	videoCount := 0
+	for _, f := range t.Files() {
+		if detectMediaType(f.Path()) == "video" {
+			videoCount++
+		}
+	}
+
+	var sidecars []*torrent.File
+	for _, f := range t.Files() {
+		if !isSidecarSubtitle(f.Path()) {
+			continue
+		}
+
+		dir := path.Dir(f.Path())
+		sameName := hasBaseName(path.Base(f.Path()), videoBase)
+
+		switch {
+		case dir == videoDir && sameName:
+			sidecars = append(sidecars, f)
+		case path.Dir(dir) == videoDir && subtitleDirNames[strings.ToLower(path.Base(dir))] && (videoCount == 1 || sameName):
+			sidecars = append(sidecars, f)
+		case strings.EqualFold(path.Base(dir), videoBase) && path.Dir(path.Dir(dir)) == videoDir &&
+			subtitleDirNames[strings.ToLower(path.Base(path.Dir(dir)))]:
+			sidecars = append(sidecars, f)
+		}
+	}
+
+	return sidecars
+}
+
+// hasBaseName verifica se o nome do arquivo começa com o nome base do vídeo
+func hasBaseName(name, videoBase string) bool {
+	return strings.HasPrefix(strings.ToLower(name), strings.ToLower(videoBase)+".")
+}
+
+// detectSubtitleLanguage deduz idioma e "forced" pelo nome do arquivo de legenda
+func detectSubtitleLanguage(name, videoBase string) (lang string, forced bool) {
+	rest := strings.TrimSuffix(name, path.Ext(name))
+	if hasBaseName(name, videoBase) {
+		rest = rest[len(videoBase):]
+	}
+
+	lang = "und"
+	tokens := strings.FieldsFunc(strings.ToLower(rest), func(r rune) bool {
+		return r == '.' || r == '_' || r == ' ' || r == '[' || r == ']' || r == '(' || r == ')'
+	})
+	for _, token := range tokens {
+		if token == "forced" || token == "forçada" {
+			forced = true
+			continue
+		}
+		if code, ok := subtitleLanguageAliases[token]; ok {
+			lang = code
+		}
+	}
+	return lang, forced
+}
+
+// sidecarSubtitleTracks descreve as legendas externas do arquivo atual.
+// A numeração das renditions continua a partir das legendas embutidas.
+func sidecarSubtitleTracks(stream *StreamInfo, first int) []SubtitleTrackInfo {
+	stream.mu.Lock()
+	sidecars := stream.sidecars
+	fileName := stream.media.FileName
+	stream.mu.Unlock()
+
+	videoBase := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+
+	tracks := make([]SubtitleTrackInfo, 0, len(sidecars))
+	for i, f := range sidecars {
+		name := path.Base(f.Path())
+		lang, forced := detectSubtitleLanguage(name, videoBase)
+
+		title := getLanguageName(lang)
+		if lang == "und" {
+			title = name
+		}
+		if forced {
+			title += " (Forçada)"
+		}
+
+		tracks = append(tracks, SubtitleTrackInfo{
+			Index:       -1,
+			StreamIndex: -1,
+			Language:    lang,
+			Title:       title,
+			Codec:       strings.TrimPrefix(strings.ToLower(path.Ext(name)), "."),
+			Forced:      forced,
+			Rendition:   fmt.Sprintf("sub%d", first+i),
+			Source:      "sidecar",
+			file:        f,
+		})
+	}
+
+	if len(tracks) > 0 {
+		log.Printf("[%s] 💬 Legendas externas encontradas: %d", stream.ID[:8], len(tracks))
+		for _, t := range tracks {
+			log.Printf("   - %s (%s) - %s", t.Title, t.Language, t.file.Path())
+		}
+	}
+
+	return tracks
+}
+
+// waitSidecarDownloaded aguarda o arquivo de legenda externo estar completo
+func waitSidecarDownloaded(f *torrent.File, done chan struct{}) bool {
+	for f.BytesCompleted() < f.Length() {
+		select {
+		case <-done:
+			return false
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package torrent
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+)
+
+func TestDetectSubtitleLanguage(t *testing.T) {
+	tests := []struct {
+		name   string
+		lang   string
+		forced bool
+	}{
+		{"Filme.srt", "und", false},
+		{"Filme.pt-BR.srt", "por", false},
+		{"Filme.eng.forced.srt", "eng", true},
+		{"Filme.Forced.Portuguese.ass", "por", true},
+		{"Filme [ES].vtt", "spa", false},
+		{"2_English.srt", "eng", false}, // Pasta Subs/<vídeo>/ com nome próprio
+		{"Filme.commentary.srt", "und", false},
+	}
+	for _, tt := range tests {
+		lang, forced := detectSubtitleLanguage(tt.name, "Filme")
+		if lang != tt.lang || forced != tt.forced {
+			t.Errorf("%s: idioma %q, forçada %v; esperado %q, %v", tt.name, lang, forced, tt.lang, tt.forced)
+		}
+	}
+}
+
+func TestFindSidecarSubtitles(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]int64
+		video string
+		want  []string
+	}{
+		{
+			"mesma pasta e nome base",
+			map[string]int64{"Filme.mkv": 9000, "Filme.pt-BR.srt": 10, "Filme.en.ass": 10, "Outro.srt": 10, "Filme.idx.sub": 10},
+			"Filme.mkv",
+			[]string{"Filme.en.ass", "Filme.pt-BR.srt"},
+		},
+		{
+			"pasta Subs com um único vídeo",
+			map[string]int64{"Filme.mkv": 9000, "Subs/English.srt": 10, "Subs/Portuguese.srt": 10},
+			"Filme.mkv",
+			[]string{"Subs/English.srt", "Subs/Portuguese.srt"},
+		},
+		{
+			"pack de temporada: Subs/<episódio>/",
+			map[string]int64{
+				"S01E01.mkv": 9000, "S01E02.mkv": 9000,
+				"Subs/S01E01/2_English.srt": 10, "Subs/S01E02/2_English.srt": 10,
+				"Subs/Geral.srt": 10,
+			},
+			"S01E02.mkv",
+			[]string{"Subs/S01E02/2_English.srt"},
+		},
+		{
+			"pasta Subs com vários vídeos exige o nome",
+			map[string]int64{"S01E01.mkv": 9000, "S01E02.mkv": 9000, "Subs/S01E01.eng.srt": 10, "Subs/S01E02.eng.srt": 10},
+			"S01E01.mkv",
+			[]string{"Subs/S01E01.eng.srt"},
+		},
+	}
+	for _, tt := range tests {
+		tor := newTestTorrent(t, tt.files)
+		var video *torrent.File
+		for _, f := range tor.Files() {
+			if filePath(f) == tt.video {
+				video = f
+			}
+		}
+
+		var got []string
+		for _, f := range findSidecarSubtitles(tor, video) {
+			got = append(got, filePath(f))
+		}
+		sort.Strings(got)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: %v, esperado %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: %v, esperado %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
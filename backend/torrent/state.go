@@ -0,0 +1,219 @@
+package torrent
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// StreamState é o estado do ciclo de vida de um stream
+type StreamState string
+
+const (
+	StateDownloading StreamState = "downloading" // Baixando o bloco inicial do arquivo
+	StateTranscoding StreamState = "transcoding" // FFmpeg iniciado, aguardando a primeira qualidade
+	StateReady       StreamState = "ready"       // Ao menos uma qualidade com segmentos, player liberado
+	StateError       StreamState = "error"       // Falha; só sai daqui trocando de arquivo
+)
+
+// Transições permitidas. Voltar para downloading não está aqui: só a troca de arquivo
+// (resetForFile) faz isso, a partir de qualquer estado (inclusive downloading e error).
+var stateTransitions = map[StreamState][]StreamState{
+	StateDownloading: {StateTranscoding, StateError},
+	StateTranscoding: {StateReady, StateError},
+	StateReady:       {StateError},
+	StateError:       {},
+}
+
+// CanTransition informa se a transição de s para to é válida
+func (s StreamState) CanTransition(to StreamState) bool {
+	for _, next := range stateTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// mediaInfo descreve o arquivo sendo reproduzido (preenchido pelo pipeline, protegido por mu)
+type mediaInfo struct {
+	FileName       string
+	VideoFile      string // Caminho em disco
+	FileIndex      int    // Índice em t.Files() (-1 = ainda não escolhido)
+	SourceWidth    int
+	SourceHeight   int
+	AudioTracks    []AudioTrackInfo
+	SubtitleTracks []SubtitleTrackInfo
+	Duration       float64 // Segundos (0 = desconhecida)
+	FrameRate      float64 // Quadros por segundo da fonte (0 = desconhecido)
+	Color          VideoColorInfo
+	Geometry       VideoGeometry
+}
+
+// StreamSnapshot é uma cópia consistente do estado de um stream,
+// segura para ser lida sem travas (ex: ao montar a resposta de status)
+type StreamSnapshot struct {
+	ID             string
+	InfoHash       string
+	State          StreamState
+	Progress       float64
+	Error          string
+	Qualities      []string
+	Transcodes     []QualityProgress // Progresso de cada qualidade, na ordem da escada
+	HLSPath        string
+	FileName       string
+	FileIndex      int
+	SourceWidth    int
+	SourceHeight   int
+	AudioTracks    []AudioTrackInfo
+	SubtitleTracks []SubtitleTrackInfo
+	Duration       float64
+	HDRFormat      string // Formato HDR da fonte ("" = SDR)
+	CreatedAt      time.Time
+}
+
+// Snapshot retorna uma cópia do estado atual do stream
+func (s *StreamInfo) Snapshot() StreamSnapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return StreamSnapshot{
+		ID:             s.ID,
+		InfoHash:       s.InfoHash,
+		State:          s.state,
+		Progress:       s.progress,
+		Error:          s.errMsg,
+		Qualities:      append([]string(nil), s.qualities...),
+		Transcodes:     s.qualityProgressLocked(),
+		HLSPath:        s.hlsPath,
+		FileName:       s.media.FileName,
+		FileIndex:      s.media.FileIndex,
+		SourceWidth:    s.media.SourceWidth,
+		SourceHeight:   s.media.SourceHeight,
+		AudioTracks:    append([]AudioTrackInfo(nil), s.media.AudioTracks...),
+		SubtitleTracks: append([]SubtitleTrackInfo(nil), s.media.SubtitleTracks...),
+		Duration:       s.media.Duration,
+		HDRFormat:      s.media.Color.HDRFormat,
+		CreatedAt:      s.CreatedAt,
+	}
+}
+
+// State retorna o estado atual do stream
+func (s *StreamInfo) State() StreamState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// setState aplica uma transição validada e publica o evento "status".
+// Transições impossíveis (ex: error -> ready) são rejeitadas.
+func (s *StreamInfo) setState(to StreamState) error {
+	return s.transition(to, "", nil)
+}
+
+// fail leva o stream para o estado de erro.
+// Se ele já estiver em erro, a primeira mensagem é mantida.
+func (s *StreamInfo) fail(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	if err := s.transition(StateError, msg, nil); err != nil {
+		log.Printf("[%s] ⚠️ Erro ignorado (%v): %s", s.ID[:8], err, msg)
+	}
+}
+
+// markReady libera o player com a primeira qualidade pronta
+func (s *StreamInfo) markReady(quality string) error {
+	return s.transition(StateReady, "", func() {
+		if !containsString(s.qualities, quality) {
+			s.qualities = append(s.qualities, quality)
+		}
+	})
+}
+
+// transition valida e aplica a mudança de estado; apply roda sob a trava junto com ela
+func (s *StreamInfo) transition(to StreamState, errMsg string, apply func()) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.state.CanTransition(to) {
+		return fmt.Errorf("transição de status inválida: %s -> %s", s.state, to)
+	}
+	s.applyTransitionLocked(to, errMsg, apply)
+	return nil
+}
+
+// applyTransitionLocked aplica a mudança de estado e publica o evento "status" sob a mesma
+// trava: os assinantes recebem as transições na ordem em que foram aplicadas (requer s.mu)
+func (s *StreamInfo) applyTransitionLocked(to StreamState, errMsg string, apply func()) {
+	from := s.state
+	s.state = to
+	s.errMsg = errMsg
+	if apply != nil {
+		apply()
+	}
+
+	log.Printf("[%s] Status: %s -> %s", s.ID[:8], from, to)
+	s.publishLocked(StreamEvent{Type: "status", Data: StatusEvent{Status: to, Previous: from, Error: errMsg}})
+}
+
+// resetForFile volta o stream para downloading ao trocar de arquivo (a partir de qualquer
+// estado), descartando o que foi produzido para o arquivo anterior
+func (s *StreamInfo) resetForFile() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.applyTransitionLocked(StateDownloading, "", func() {
+		s.progress = 0
+		s.qualities = nil
+		s.ladder = nil
+		s.audioRenditions = nil
+		s.vodPlaylists = false
+		s.thumbnails = nil
+		s.encoding = nil
+		s.qualityCmds = nil
+		s.jobs = nil
+		s.readahead = 0
+		s.seeks = nil
+		s.requests = nil
+		s.resumes = nil
+		s.media = mediaInfo{
+			FileName:  s.media.FileName,
+			VideoFile: s.media.VideoFile,
+			FileIndex: s.media.FileIndex,
+		}
+	})
+}
+
+// setProgress atualiza o progresso do download do arquivo atual (0-100)
+func (s *StreamInfo) setProgress(progress float64) {
+	s.mu.Lock()
+	s.progress = progress
+	s.mu.Unlock()
+}
+
+// setHLSPath define o diretório HLS do stream
+func (s *StreamInfo) setHLSPath(dir string) {
+	s.mu.Lock()
+	s.hlsPath = dir
+	s.mu.Unlock()
+}
+
+// hlsDir retorna o diretório HLS do stream ("" antes da transcodificação)
+func (s *StreamInfo) hlsDir() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hlsPath
+}
+
+// currentMedia retorna uma cópia das informações do arquivo atual
+func (s *StreamInfo) currentMedia() mediaInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.media
+}
+
+// updateMedia altera as informações do arquivo atual sob a trava
+func (s *StreamInfo) updateMedia(update func(m *mediaInfo)) {
+	s.mu.Lock()
+	update(&s.media)
+	s.mu.Unlock()
+}
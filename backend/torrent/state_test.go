@@ -0,0 +1,208 @@
+package torrent
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Cada transição loga; nos testes isso só polui a saída
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestStream cria um stream em memória, sem torrent nem FFmpeg
+func newTestStream(state StreamState) *StreamInfo {
+	return &StreamInfo{
+		ID:         "teststream-0000",
+		state:      state,
+		media:      mediaInfo{FileIndex: -1},
+		cancelChan: make(chan struct{}),
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	states := []StreamState{StateDownloading, StateTranscoding, StateReady, StateError}
+	allowed := map[[2]StreamState]bool{
+		{StateDownloading, StateTranscoding}: true,
+		{StateDownloading, StateError}:       true,
+		{StateTranscoding, StateReady}:       true,
+		{StateTranscoding, StateError}:       true,
+		{StateReady, StateError}:             true,
+	}
+
+	for _, from := range states {
+		for _, to := range states {
+			want := allowed[[2]StreamState{from, to}]
+			if got := from.CanTransition(to); got != want {
+				t.Errorf("%s -> %s: CanTransition = %v, esperado %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestTransitionRejected(t *testing.T) {
+	tests := []struct {
+		from StreamState
+		to   StreamState
+	}{
+		{StateError, StateReady},
+		{StateError, StateTranscoding},
+		{StateReady, StateTranscoding},
+		{StateDownloading, StateReady},
+		// Voltar para downloading só pela troca de arquivo
+		{StateDownloading, StateDownloading},
+		{StateReady, StateDownloading},
+		{StateError, StateDownloading},
+	}
+
+	for _, tt := range tests {
+		s := newTestStream(tt.from)
+		if err := s.setState(tt.to); err == nil {
+			t.Errorf("%s -> %s: setState aceitou", tt.from, tt.to)
+		}
+		if got := s.State(); got != tt.from {
+			t.Errorf("%s -> %s: estado mudou para %s", tt.from, tt.to, got)
+		}
+	}
+}
+
+func TestResetForFileFromAnyState(t *testing.T) {
+	for _, from := range []StreamState{StateDownloading, StateTranscoding, StateReady, StateError} {
+		s := newTestStream(from)
+		s.errMsg = "falha anterior"
+		s.qualities = []string{"720p"}
+		s.progress = 42
+
+		s.resetForFile()
+
+		snap := s.Snapshot()
+		if snap.State != StateDownloading || snap.Error != "" || len(snap.Qualities) != 0 || snap.Progress != 0 {
+			t.Errorf("resetForFile a partir de %s: %+v", from, snap)
+		}
+	}
+}
+
+func TestFailKeepsFirstError(t *testing.T) {
+	s := newTestStream(StateTranscoding)
+	s.fail("primeira")
+	s.fail("segunda")
+
+	if snap := s.Snapshot(); snap.State != StateError || snap.Error != "primeira" {
+		t.Errorf("estado %s, erro %q; esperado error, \"primeira\"", snap.State, snap.Error)
+	}
+}
+
+// Snapshot lido enquanto transições, progresso e trocas de arquivo acontecem (rodar com -race)
+func TestSnapshotConcurrentWithTransitions(t *testing.T) {
+	s := newTestStream(StateDownloading)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				snap := s.Snapshot()
+				// Erro só existe no estado de erro
+				if snap.Error != "" && snap.State != StateError {
+					t.Errorf("erro %q no estado %s", snap.Error, snap.State)
+					return
+				}
+			}
+		}()
+	}
+
+	var writers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		writers.Add(1)
+		go func(i int) {
+			defer writers.Done()
+			for n := 0; n < 200; n++ {
+				switch (n + i) % 6 {
+				case 0:
+					s.setState(StateTranscoding)
+				case 1:
+					s.markReady(fmt.Sprintf("q%d", i))
+				case 2:
+					s.setProgress(float64(n))
+				case 3:
+					s.fail("falha %d", n)
+				case 4:
+					s.resetForFile()
+				case 5:
+					s.setHLSPath(fmt.Sprintf("/tmp/hls%d", n))
+				}
+			}
+		}(i)
+	}
+
+	writers.Wait()
+	close(stop)
+	wg.Wait()
+}
+
+// Cada evento "status" descreve a transição que de fato foi aplicada, na ordem em que foi aplicada
+func TestStatusEventsMatchAppliedState(t *testing.T) {
+	for round := 0; round < 100; round++ {
+		s := newTestStream(StateDownloading)
+		events, unsubscribe := s.Subscribe()
+
+		// Poucas transições por rodada: o buffer do assinante (32) não transborda
+		var wg sync.WaitGroup
+		for i := 0; i < 6; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				switch i % 3 {
+				case 0:
+					s.setState(StateTranscoding)
+					s.markReady("720p")
+				case 1:
+					s.fail("falha %d", i)
+				case 2:
+					s.resetForFile()
+				}
+			}(i)
+		}
+		wg.Wait()
+		unsubscribe()
+
+		previous := StateDownloading
+		var last StatusEvent
+		for len(events) > 0 {
+			event := <-events
+			status, ok := event.Data.(StatusEvent)
+			if event.Type != "status" || !ok {
+				t.Fatalf("evento inesperado: %+v", event)
+			}
+			if status.Previous != previous {
+				t.Fatalf("rodada %d: evento %s -> %s, mas o estado anterior era %s", round, status.Previous, status.Status, previous)
+			}
+			if !status.Previous.CanTransition(status.Status) && status.Status != StateDownloading { // downloading: resetForFile
+				t.Fatalf("rodada %d: transição inválida publicada: %s -> %s", round, status.Previous, status.Status)
+			}
+			previous = status.Status
+			last = status
+		}
+
+		snap := s.Snapshot()
+		if snap.State != previous {
+			t.Fatalf("rodada %d: último evento %s, estado aplicado %s", round, previous, snap.State)
+		}
+		if last.Status != "" && last.Error != snap.Error {
+			t.Fatalf("rodada %d: erro do evento %q, erro aplicado %q", round, last.Error, snap.Error)
+		}
+	}
+}
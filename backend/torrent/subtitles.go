@@ -0,0 +1,178 @@
+package torrent
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Duração dos segmentos WebVTT (texto é leve, segmentos maiores reduzem requisições)
+const subtitleSegmentDuration = 10
+
+// Intervalo entre extrações de uma legenda embutida enquanto o vídeo é baixado
+const subtitleRefreshInterval = 2 * time.Minute
+
+// extractSubtitles converte cada legenda em texto do arquivo para uma playlist WebVTT segmentada.
+// Legendas embutidas ficam espalhadas pelo arquivo inteiro: a extração é refeita conforme o
+// download avança, até uma última passada com o vídeo completo (ver extractSubtitleTrack).
+func extractSubtitles(stream *StreamInfo, tracks []SubtitleTrackInfo, done chan struct{}) {
+	for _, track := range tracks {
+		go func(track SubtitleTrackInfo) {
+			if err := extractSubtitleTrack(stream, track, done); err != nil {
+				log.Printf("[%s] ⚠️ Erro ao extrair legenda %s: %v", stream.ID[:8], track.Rendition, err)
+			}
+		}(track)
+	}
+}
+
+// extractSubtitleTrack gera <rendition>/playlist.m3u8 e segmentos .vtt para uma faixa.
+// Uma legenda externa é extraída uma vez, depois de baixada. Uma embutida é extraída do
+// vídeo parcial (só o trecho já baixado) e de novo a cada subtitleRefreshInterval se o
+// download avançou; enquanto o vídeo não termina a playlist é EVENT, sem #EXT-X-ENDLIST,
+// e o player continua recarregando-a.
+func extractSubtitleTrack(stream *StreamInfo, track SubtitleTrackInfo, done chan struct{}) error {
+	select {
+	case <-done:
+		return nil
+	default:
+	}
+
+	subDir := filepath.Join(stream.hlsDir(), track.Rendition)
+	if err := os.MkdirAll(subDir, 0755); err != nil {
+		return err
+	}
+
+	// Legenda embutida: lida do vídeo. Externa: lida do próprio arquivo, depois de baixado.
+	input := stream.currentMedia().VideoFile
+	streamMap := fmt.Sprintf("0:s:%d", track.Index)
+	if track.file != nil {
+		if !waitSidecarDownloaded(track.file, done) {
+			return nil
+		}
+		input = filepath.Join("./downloads", track.file.Path())
+		streamMap = "0:s:0"
+	}
+
+	log.Printf("[%s] 💬 Extraindo legenda %s (%s, %s)", stream.ID[:8], track.Rendition, track.Language, track.Codec)
+
+	extracted := int64(-1)
+	for {
+		// Verificado antes da extração: a passada com o vídeo completo é a final
+		complete, downloaded := true, int64(0)
+		if track.file == nil {
+			complete, downloaded = stream.videoDownloaded()
+		}
+
+		if downloaded != extracted {
+			err := runSubtitleExtraction(stream, track, input, streamMap, subDir)
+			select {
+			case <-done:
+				return nil
+			default:
+			}
+			if err == nil {
+				err = publishSubtitlePlaylist(subDir, complete)
+			}
+			switch {
+			case err == nil:
+				extracted = downloaded
+			case complete:
+				return err
+			default:
+				log.Printf("[%s] ⚠️ Legenda %s: extração parcial falhou, tentando de novo: %v", stream.ID[:8], track.Rendition, err)
+			}
+		}
+
+		if complete && downloaded == extracted {
+			log.Printf("[%s] 💬 Legenda %s extraída", stream.ID[:8], track.Rendition)
+			return nil
+		}
+
+		select {
+		case <-done:
+			return nil
+		case <-time.After(subtitleRefreshInterval):
+		}
+	}
+}
+
+// runSubtitleExtraction roda uma passada do FFmpeg sobre a entrada, regravando os segmentos
+// e a lista de segmentos do FFmpeg (encoder.m3u8)
+func runSubtitleExtraction(stream *StreamInfo, track SubtitleTrackInfo, input, streamMap, subDir string) error {
+	args := []string{
+		"-y",
+		"-fflags", "+genpts+igndts+discardcorrupt",
+		"-err_detect", "ignore_err",
+		"-i", input,
+		"-map", streamMap,
+		"-c:s", "webvtt",
+		"-f", "segment",
+		"-segment_time", fmt.Sprintf("%d", subtitleSegmentDuration),
+		"-segment_format", "webvtt",
+		"-segment_list", filepath.Join(subDir, encoderPlaylistName),
+		"-segment_list_type", "m3u8",
+		filepath.Join(subDir, "segment%03d.vtt"),
+	}
+
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stderr = os.Stderr
+	stream.trackFFmpeg(cmd)
+
+	// Legendas são baratas, mas também passam pelo orçamento de processos do scheduler
+	return runScheduled(stream, TaskSubtitle, []string{track.Rendition}, cmd)
+}
+
+// publishSubtitlePlaylist gera a playlist.m3u8 servida a partir da lista do FFmpeg.
+// Antes da passada final ela é EVENT e sem #EXT-X-ENDLIST (o FFmpeg sempre o escreve).
+func publishSubtitlePlaylist(subDir string, final bool) error {
+	data, err := os.ReadFile(filepath.Join(subDir, encoderPlaylistName))
+	if err != nil {
+		return err
+	}
+
+	playlistType := "#EXT-X-PLAYLIST-TYPE:EVENT"
+	if final {
+		playlistType = "#EXT-X-PLAYLIST-TYPE:VOD"
+	}
+
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-PLAYLIST-TYPE"):
+			continue
+		case line == "#EXT-X-ENDLIST" && !final:
+			continue
+		}
+		b.WriteString(line + "\n")
+		if line == "#EXTM3U" {
+			b.WriteString(playlistType + "\n")
+		}
+	}
+
+	// Escrita atômica: o player recarrega a playlist enquanto ela é regravada
+	path := filepath.Join(subDir, "playlist.m3u8")
+	if err := os.WriteFile(path+".tmp", []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// videoDownloaded informa se o arquivo de vídeo atual está completo e quantos bytes dele já foram baixados
+func (s *StreamInfo) videoDownloaded() (bool, int64) {
+	s.mu.Lock()
+	t := s.torrent
+	fileIndex := s.media.FileIndex
+	s.mu.Unlock()
+
+	if t == nil || t.Info() == nil || fileIndex < 0 {
+		return false, 0
+	}
+	f := t.Files()[fileIndex]
+	completed := f.BytesCompleted()
+	return completed >= f.Length(), completed
+}
@@ -0,0 +1,250 @@
+package torrent
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Sem avanço na saída do FFmpeg por esse tempo, o job é considerado travado
+const stallTimeout = 90 * time.Second
+
+// Intervalo de verificação de jobs travados
+const stallCheckInterval = 15 * time.Second
+
+// Quantas vezes seguidas uma rendition pode ser retomada no mesmo segmento antes de desistir
+const supervisorMaxAttempts = 5
+
+// resumeRecord conta as retomadas seguidas de uma rendition no mesmo segmento
+type resumeRecord struct {
+	Segment  int
+	Attempts int
+}
+
+// endedEarly informa se um FFmpeg que terminou parou antes do fim do vídeo
+// (tolerância de um segmento: áudio e vídeo raramente terminam no mesmo instante).
+// A duração é a do container: uma faixa mais curta que ela termina sem erro antes disso,
+// então uma saída limpa com o arquivo inteiro baixado é sempre o fim da rendition.
+func endedEarly(duration, outTime float64, segmentDuration int, clean, downloaded bool) bool {
+	if clean && downloaded {
+		return false
+	}
+	return duration > 0 && outTime < duration-float64(segmentDuration)
+}
+
+// fileDownloaded informa se o arquivo reproduzido já foi baixado por completo
+func (s *StreamInfo) fileDownloaded() bool {
+	s.mu.Lock()
+	t, index := s.torrent, s.media.FileIndex
+	s.mu.Unlock()
+	if t == nil || t.Info() == nil || index < 0 {
+		return false
+	}
+	files := t.Files()
+	if index >= len(files) {
+		return false
+	}
+	return files[index].BytesCompleted() == files[index].Length()
+}
+
+// lastProducedSegment retorna o último segmento da sequência contínua gerada a partir de from
+// (from-1 se nem ele existe)
+func lastProducedSegment(dir string, from int) int {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return from - 1
+	}
+	produced := make(map[int]bool, len(files))
+	for _, f := range files {
+		if num, ok := parseSegmentNumber(f.Name()); ok {
+			produced[num] = true
+		}
+	}
+	last := from - 1
+	for produced[last+1] {
+		last++
+	}
+	return last
+}
+
+// resumable informa se o FFmpeg dessas renditions pode ser retomado no meio do vídeo.
+// A variante "original" (stream copy) não: sem reencode não há keyframe no ponto de
+// retomada, e os segmentos regerados não bateriam com os que já estão na playlist.
+func resumable(stream *StreamInfo, names []string) bool {
+	quality, ok := stream.findQuality(names[0])
+	return !ok || !quality.Copy
+}
+
+// jobsWaiting informa se todos os jobs continuam sendo os atuais e aguardando retomada
+// (um seek, a troca de arquivo ou o encerramento por ociosidade cancelam a retomada)
+func (s *StreamInfo) jobsWaiting(jobs []*qualityJob) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range jobs {
+		if s.jobs[job.progress.Quality] != job || job.progress.State != JobWaiting {
+			return false
+		}
+	}
+	return true
+}
+
+// recordResume registra uma retomada no segmento e informa se ainda vale tentar
+func (s *StreamInfo) recordResume(name string, segment int) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.resumes == nil {
+		s.resumes = make(map[string]resumeRecord)
+	}
+	record := s.resumes[name]
+	if record.Segment == segment {
+		record.Attempts++
+	} else {
+		record = resumeRecord{Segment: segment, Attempts: 1}
+	}
+	s.resumes[name] = record
+	return record.Attempts, record.Attempts <= supervisorMaxAttempts
+}
+
+// resumeJob retoma um FFmpeg que terminou antes do fim do vídeo (em geral ao chegar a um
+// trecho do arquivo parcial que ainda não foi baixado, ou depois de travar): aguarda as
+// peças da posição de retomada e reinicia a partir do último segmento gerado, mantendo a
+// numeração. O último segmento é regerado porque um encerramento limpo grava o segmento
+// em andamento incompleto.
+func resumeJob(stream *StreamInfo, names []string, jobs []*qualityJob, hlsDir string, start float64, done chan struct{}) {
+	if done == nil {
+		return
+	}
+	select {
+	case <-done:
+		return
+	default:
+	}
+
+	stream.mu.Lock()
+	t := stream.torrent
+	stream.mu.Unlock()
+
+	media := stream.currentMedia()
+	segmentDuration := stream.encodingConfig().SegmentDuration
+	startSegment := int(start) / segmentDuration
+
+	// No pipeline único todas as qualidades recomeçam juntas: do menor avanço entre elas
+	resume := -1
+	for _, name := range names {
+		last := lastProducedSegment(filepath.Join(hlsDir, name), startSegment)
+		if last < startSegment {
+			last = startSegment
+		}
+		if resume == -1 || last < resume {
+			resume = last
+		}
+	}
+	seek := seekPoint{Time: float64(resume * segmentDuration), Segment: resume, Restart: true}
+
+	label := fmt.Sprintf("%v", names)
+	attempts, ok := stream.recordResume(names[0], resume)
+	if !ok {
+		reason := fmt.Sprintf("FFmpeg parou %d vezes no segmento %d", supervisorMaxAttempts, resume)
+		log.Printf("[%s] ❌ %s: %s, desistindo", stream.ID[:8], label, reason)
+		for _, job := range jobs {
+			stream.updateJob(job, func(p *QualityProgress) {
+				if p.State == JobWaiting {
+					p.State = JobFailed
+					p.Error = reason
+				}
+			})
+		}
+		return
+	}
+
+	// Aguardar o trecho a partir da retomada (maior a cada tentativa no mesmo segmento)
+	if t != nil && t.Info() != nil && media.FileIndex >= 0 && media.Duration > 0 {
+		videoFile := t.Files()[media.FileIndex]
+		pieceLength := int64(t.Info().PieceLength)
+		fileLength := videoFile.Length()
+
+		byteOffset := int64(float64(fileLength)*(seek.Time/media.Duration)) - seekMarginBytes
+		if byteOffset < 0 {
+			byteOffset = 0
+		}
+		lastPieceIndex := int((videoFile.Offset() + fileLength - 1) / pieceLength)
+		startPiece := int((videoFile.Offset() + byteOffset) / pieceLength)
+		readyPiece := int((videoFile.Offset() + byteOffset + seekReadyBytes*int64(attempts)) / pieceLength)
+		if readyPiece > lastPieceIndex {
+			readyPiece = lastPieceIndex
+		}
+
+		if firstIncompletePiece(t, startPiece, readyPiece) != -1 {
+			log.Printf("[%s] ⏳ %s: aguardando peças %d-%d para retomar no segmento %d", stream.ID[:8], label, startPiece, readyPiece, resume)
+		}
+		for firstIncompletePiece(t, startPiece, readyPiece) != -1 {
+			select {
+			case <-done:
+				return
+			case <-time.After(2 * time.Second):
+			}
+			if !stream.jobsWaiting(jobs) {
+				return
+			}
+		}
+	}
+
+	if !stream.jobsWaiting(jobs) {
+		return
+	}
+
+	log.Printf("[%s] 🔁 %s: retomando no segmento %d (%.0fs), tentativa %d", stream.ID[:8], label, resume, seek.Time, attempts)
+
+	var err error
+	if quality, ok := stream.findQuality(names[0]); ok {
+		err = restartQualityAt(stream, quality, seek, done)
+	} else if audio, ok := stream.findAudioRendition(names[0]); ok {
+		err = restartAudioAt(stream, audio, seek, done)
+	} else {
+		return
+	}
+	if err != nil {
+		log.Printf("[%s] ⚠️ %s: erro ao retomar FFmpeg: %v", stream.ID[:8], label, err)
+		for _, job := range jobs {
+			stream.failJob(job, err.Error())
+		}
+	}
+}
+
+// superviseStalls encerra FFmpeg cuja saída parou de avançar. O encerramento cai no mesmo
+// caminho de um término prematuro: as peças são aguardadas e o job é retomado. A variante
+// "original" não é retomada (ver resumable), então não é encerrada.
+func superviseStalls(stream *StreamInfo, done chan struct{}) {
+	ticker := time.NewTicker(stallCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		for _, w := range stream.runningWorkers() {
+			stalled := true
+			var idle time.Duration
+			stream.mu.Lock()
+			for _, job := range w.jobs {
+				// Na fila ou pausado pelo scheduler não é travamento
+				if job.progress.State != JobRunning || time.Since(job.advancedAt) < stallTimeout {
+					stalled = false
+					break
+				}
+				idle = time.Since(job.advancedAt)
+			}
+			stream.mu.Unlock()
+
+			if stalled && len(w.jobs) > 0 && resumable(stream, []string{w.jobs[0].progress.Quality}) {
+				log.Printf("[%s] 🧊 %s: sem avanço há %.0fs, reiniciando FFmpeg", stream.ID[:8], w.jobs[0].progress.Quality, idle.Seconds())
+				stopFFmpeg(w.cmd)
+			}
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package torrent
+
+import "testing"
+
+func TestEndedEarly(t *testing.T) {
+	tests := []struct {
+		name       string
+		duration   float64
+		outTime    float64
+		clean      bool
+		downloaded bool
+		want       bool
+	}{
+		{"chegou ao fim", 600, 599, true, true, false},
+		{"dentro da tolerância de um segmento", 600, 598.5, false, false, false},
+		{"erro no meio do arquivo parcial", 600, 120, false, false, true},
+		{"saída limpa com arquivo parcial", 600, 120, true, false, true},
+		{"erro com arquivo completo", 600, 120, false, true, true},
+		{"faixa mais curta que o container", 600, 540, true, true, false},
+		{"duração desconhecida", 0, 120, false, false, false},
+	}
+	for _, tt := range tests {
+		if got := endedEarly(tt.duration, tt.outTime, 2, tt.clean, tt.downloaded); got != tt.want {
+			t.Errorf("%s: endedEarly = %v, esperado %v", tt.name, got, tt.want)
+		}
+	}
+}
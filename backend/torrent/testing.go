@@ -0,0 +1,41 @@
+package torrent
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RegisterTestStream registra em memória um stream já transcodificando, sem torrent nem
+// FFmpeg, com a sessão de um primeiro espectador. Só para testes de outros pacotes
+// (handlers): quem entra depois usa StartStream com o mesmo info hash.
+func RegisterTestStream(infoHash, hlsPath string, ladder []QualityLevel) (sessionID string, stream *StreamInfo) {
+	infoHash = strings.ToLower(infoHash)
+	stream = &StreamInfo{
+		ID:         uuid.New().String(),
+		InfoHash:   infoHash,
+		CreatedAt:  time.Now(),
+		state:      StateTranscoding,
+		hlsPath:    hlsPath,
+		ladder:     ladder,
+		media:      mediaInfo{FileIndex: -1},
+		cancelChan: make(chan struct{}),
+	}
+	sessionID = uuid.New().String()
+
+	mu.Lock()
+	streams[stream.ID] = stream
+	byHash[infoHash] = stream.ID
+	sessions[sessionID] = viewerSession{StreamID: stream.ID, LastSeen: time.Now()}
+	stream.viewers = 1
+	mu.Unlock()
+	return sessionID, stream
+}
+
+// RemoveTestStream desfaz RegisterTestStream (stream e todas as sessões ligadas a ele)
+func RemoveTestStream(stream *StreamInfo) {
+	mu.Lock()
+	forgetStreamLocked(stream)
+	mu.Unlock()
+}
@@ -0,0 +1,325 @@
+package torrent
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Rendition das miniaturas do seek bar (<hls>/thumbs)
+const thumbnailRendition = "thumbs"
+
+// Geometria das miniaturas: uma a cada thumbnailInterval segundos, em folhas de
+// thumbnailColumns x thumbnailRows (25 miniaturas = ~4min de vídeo por JPEG)
+const (
+	thumbnailInterval = 10
+	thumbnailWidth    = 240
+	thumbnailColumns  = 5
+	thumbnailRows     = 5
+)
+
+// Tamanho médio estimado de uma miniatura JPEG (BANDWIDTH do EXT-X-IMAGE-STREAM-INF)
+const thumbnailBytesEstimate = 8 * 1024
+
+// Tentativas de gerar uma folha antes de desistir dela
+const thumbnailMaxAttempts = 3
+
+// thumbnailSet descreve as folhas de miniaturas do arquivo atual
+type thumbnailSet struct {
+	Width    int // Tamanho de cada miniatura
+	Height   int
+	Sheets   int     // Número de folhas (sprite000.jpg ...)
+	Duration float64 // Duração do vídeo coberta
+}
+
+// perSheet é o número de miniaturas em uma folha
+func (t thumbnailSet) perSheet() int {
+	return thumbnailColumns * thumbnailRows
+}
+
+// sheetSpan é o trecho de vídeo coberto por uma folha (segundos)
+func (t thumbnailSet) sheetSpan() float64 {
+	return float64(t.perSheet() * thumbnailInterval)
+}
+
+// newThumbnailSet calcula as folhas para o vídeo (false se a duração for desconhecida)
+func newThumbnailSet(media mediaInfo) (thumbnailSet, bool) {
+	if media.Duration <= 0 {
+		return thumbnailSet{}, false
+	}
+
+	height := evenRound(float64(thumbnailWidth) * 9 / 16)
+	if aspect := displayAspect(media); aspect > 0 {
+		height = evenRound(float64(thumbnailWidth) / aspect)
+	}
+
+	set := thumbnailSet{Width: thumbnailWidth, Height: height, Duration: media.Duration}
+	set.Sheets = int(math.Ceil(media.Duration / set.sheetSpan()))
+	return set, true
+}
+
+// currentThumbnails retorna as miniaturas do arquivo atual (nil se não houver)
+func (s *StreamInfo) currentThumbnails() *thumbnailSet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.thumbnails
+}
+
+// ThumbnailsURL retorna a trilha WebVTT de miniaturas ("" se o arquivo não tiver)
+func (s *StreamInfo) ThumbnailsURL() string {
+	if s.currentThumbnails() == nil {
+		return ""
+	}
+	return "/api/stream/" + s.ID + "/" + thumbnailRendition + "/thumbnails.vtt"
+}
+
+// prepareThumbnails escreve a trilha WebVTT e a playlist de imagens do arquivo atual,
+// já com todas as folhas (as que faltam são aguardadas pela rota de segmentos).
+// Retorna nil se o arquivo não tiver miniaturas.
+func prepareThumbnails(stream *StreamInfo) *thumbnailSet {
+	set, ok := newThumbnailSet(stream.currentMedia())
+	if !ok {
+		log.Printf("[%s] 🖼️ Duração desconhecida, miniaturas desativadas", stream.ID[:8])
+		return nil
+	}
+
+	dir := filepath.Join(stream.hlsDir(), thumbnailRendition)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		log.Printf("[%s] ⚠️ Erro ao criar diretório de miniaturas: %v", stream.ID[:8], err)
+		return nil
+	}
+	if err := writeThumbnailTrack(dir, set); err != nil {
+		log.Printf("[%s] ⚠️ Erro ao escrever trilha de miniaturas: %v", stream.ID[:8], err)
+		return nil
+	}
+	if err := writeThumbnailPlaylist(dir, set); err != nil {
+		log.Printf("[%s] ⚠️ Erro ao escrever playlist de miniaturas: %v", stream.ID[:8], err)
+		return nil
+	}
+
+	stream.mu.Lock()
+	stream.thumbnails = &set
+	stream.mu.Unlock()
+	return &set
+}
+
+// generateThumbnails gera as folhas de miniaturas em segundo plano, à medida que o
+// download avança: uma folha só é gerada quando o trecho correspondente do arquivo
+// está completo, na ordem do vídeo.
+func generateThumbnails(stream *StreamInfo, set thumbnailSet, done chan struct{}) {
+	media := stream.currentMedia()
+	dir := filepath.Join(stream.hlsDir(), thumbnailRendition)
+
+	stream.mu.Lock()
+	t := stream.torrent
+	stream.mu.Unlock()
+
+	if t == nil || t.Info() == nil || media.FileIndex < 0 {
+		return
+	}
+	videoFile := t.Files()[media.FileIndex]
+	pieceLength := int64(t.Info().PieceLength)
+	fileLength := videoFile.Length()
+	lastPieceIndex := int((videoFile.Offset() + fileLength - 1) / pieceLength)
+
+	// Trecho de bytes de uma folha, pela taxa média do arquivo (como no seek), com margem
+	// para o keyframe anterior e variações de bitrate
+	sheetPieces := func(sheet int) (int, int) {
+		start := float64(sheet) * set.sheetSpan()
+		end := math.Min(start+set.sheetSpan(), set.Duration)
+		from := int64(float64(fileLength)*(start/set.Duration)) - seekMarginBytes
+		to := int64(float64(fileLength)*(end/set.Duration)) + seekMarginBytes
+		if from < 0 {
+			from = 0
+		}
+		if to > fileLength-1 {
+			to = fileLength - 1
+		}
+		firstPiece := int((videoFile.Offset() + from) / pieceLength)
+		lastPiece := int((videoFile.Offset() + to) / pieceLength)
+		if lastPiece > lastPieceIndex {
+			lastPiece = lastPieceIndex
+		}
+		return firstPiece, lastPiece
+	}
+
+	log.Printf("[%s] 🖼️ Miniaturas: %d folhas de %dx%d (%dx%d, uma a cada %ds)",
+		stream.ID[:8], set.Sheets, thumbnailColumns, thumbnailRows, set.Width, set.Height, thumbnailInterval)
+
+	pending := make(map[int]int) // Folha -> tentativas
+	for i := 0; i < set.Sheets; i++ {
+		pending[i] = 0
+	}
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for len(pending) > 0 {
+		// Uma folha por vez, na ordem do vídeo, entre as que já têm os dados baixados
+		for sheet := 0; sheet < set.Sheets; sheet++ {
+			attempts, ok := pending[sheet]
+			if !ok {
+				continue
+			}
+			from, to := sheetPieces(sheet)
+			if firstIncompletePiece(t, from, to) != -1 {
+				continue
+			}
+
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			if err := extractThumbnailSheet(stream, media, set, dir, sheet); err != nil {
+				attempts++
+				if attempts >= thumbnailMaxAttempts {
+					log.Printf("[%s] ⚠️ Miniaturas: folha %d falhou %d vezes, ignorando: %v", stream.ID[:8], sheet, attempts, err)
+					delete(pending, sheet)
+				} else {
+					pending[sheet] = attempts
+				}
+				continue
+			}
+			delete(pending, sheet)
+		}
+
+		if len(pending) == 0 {
+			break
+		}
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+
+	log.Printf("[%s] 🖼️ Miniaturas completas", stream.ID[:8])
+}
+
+// extractThumbnailSheet gera uma folha: lê o trecho do vídeo, tira uma miniatura a cada
+// thumbnailInterval segundos e as junta com o filtro tile
+func extractThumbnailSheet(stream *StreamInfo, media mediaInfo, set thumbnailSet, dir string, sheet int) error {
+	start := float64(sheet) * set.sheetSpan()
+
+	filters := []string{}
+	if deinterlace := deinterlaceFilter("", media.Geometry); deinterlace != "" {
+		filters = append(filters, deinterlace)
+	}
+	filters = append(filters,
+		fmt.Sprintf("fps=1/%d", thumbnailInterval),
+		fmt.Sprintf("scale=%d:%d", set.Width, set.Height),
+		"setsar=1",
+	)
+	// Fontes HDR ficam desbotadas sem o tone mapping
+	if toneMap := toneMapFilter("", media.Color); toneMap != "" {
+		filters = append(filters, toneMap)
+	}
+	filters = append(filters, fmt.Sprintf("tile=%dx%d", thumbnailColumns, thumbnailRows))
+
+	// Grava em arquivo temporário e renomeia: a rota de segmentos nunca vê uma folha pela metade
+	out := filepath.Join(dir, thumbnailSheetName(sheet))
+	tmp := out + ".part"
+
+	args := []string{
+		"-y",
+		"-fflags", "+genpts+igndts+discardcorrupt",
+		"-err_detect", "ignore_err",
+		"-ss", fmt.Sprintf("%.3f", start),
+		"-i", media.VideoFile,
+		"-t", fmt.Sprintf("%.3f", set.sheetSpan()),
+		"-map", "0:v:0",
+		"-vf", strings.Join(filters, ","),
+		"-frames:v", "1",
+		"-q:v", "5",
+		"-f", "mjpeg",
+		tmp,
+	}
+
+	var output bytes.Buffer
+	cmd := exec.Command("ffmpeg", args...)
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	stream.trackFFmpeg(cmd)
+	if err := runScheduled(stream, TaskThumbnails, []string{thumbnailRendition}, cmd); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("%v: %s", err, lastLine(output.String()))
+	}
+	return os.Rename(tmp, out)
+}
+
+// thumbnailSheetName é o nome do JPEG de uma folha
+func thumbnailSheetName(sheet int) string {
+	return fmt.Sprintf("sprite%03d.jpg", sheet)
+}
+
+// writeThumbnailTrack escreve a trilha WebVTT de miniaturas: uma cue por miniatura,
+// apontando para a região dela na folha (media fragment #xywh)
+func writeThumbnailTrack(dir string, set thumbnailSet) error {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+
+	count := int(math.Ceil(set.Duration / thumbnailInterval))
+	for i := 0; i < count; i++ {
+		start := float64(i * thumbnailInterval)
+		end := math.Min(start+thumbnailInterval, set.Duration)
+		pos := i % set.perSheet()
+		x := (pos % thumbnailColumns) * set.Width
+		y := (pos / thumbnailColumns) * set.Height
+
+		fmt.Fprintf(&b, "%s --> %s\n%s#xywh=%d,%d,%d,%d\n\n",
+			vttTimestamp(start), vttTimestamp(end), thumbnailSheetName(i/set.perSheet()), x, y, set.Width, set.Height)
+	}
+
+	return os.WriteFile(filepath.Join(dir, "thumbnails.vtt"), []byte(b.String()), 0644)
+}
+
+// writeThumbnailPlaylist escreve a playlist de imagens (#EXT-X-TILES) referenciada
+// pelo #EXT-X-IMAGE-STREAM-INF do master playlist
+func writeThumbnailPlaylist(dir string, set thumbnailSet) error {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	b.WriteString("#EXT-X-VERSION:7\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", int(set.sheetSpan()))
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+	b.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	b.WriteString("#EXT-X-IMAGES-ONLY\n")
+
+	for sheet := 0; sheet < set.Sheets; sheet++ {
+		start := float64(sheet) * set.sheetSpan()
+		span := math.Min(set.sheetSpan(), set.Duration-start)
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n", span)
+		fmt.Fprintf(&b, "#EXT-X-TILES:RESOLUTION=%dx%d,LAYOUT=%dx%d,DURATION=%d.000\n",
+			set.Width, set.Height, thumbnailColumns, thumbnailRows, thumbnailInterval)
+		b.WriteString(thumbnailSheetName(sheet) + "\n")
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+
+	return os.WriteFile(filepath.Join(dir, "playlist.m3u8"), []byte(b.String()), 0644)
+}
+
+// imageStreamInf retorna a linha do master playlist que anuncia as miniaturas
+func (t thumbnailSet) imageStreamInf() string {
+	bandwidth := thumbnailBytesEstimate * 8 / thumbnailInterval
+	return fmt.Sprintf("#EXT-X-IMAGE-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,CODECS=\"jpeg\",URI=\"%s/playlist.m3u8\"\n",
+		bandwidth, t.Width*thumbnailColumns, t.Height*thumbnailRows, thumbnailRendition)
+}
+
+// vttTimestamp formata segundos como HH:MM:SS.mmm
+func vttTimestamp(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// lastLine retorna a última linha não vazia de uma saída (erro resumido do FFmpeg)
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
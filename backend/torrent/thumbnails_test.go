@@ -0,0 +1,97 @@
+package torrent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewThumbnailSet(t *testing.T) {
+	tests := []struct {
+		name   string
+		media  mediaInfo
+		ok     bool
+		height int
+		sheets int
+	}{
+		{"duração desconhecida", mediaInfo{SourceWidth: 1920, SourceHeight: 1080}, false, 0, 0},
+		{"16:9", mediaInfo{Duration: 600, SourceWidth: 1920, SourceHeight: 1080}, true, 136, 3},
+		{"4:3", mediaInfo{Duration: 250, SourceWidth: 1440, SourceHeight: 1080}, true, 180, 1},
+		{"2.39:1", mediaInfo{Duration: 251, SourceWidth: 1920, SourceHeight: 804}, true, 100, 2},
+		{"dimensões desconhecidas: 16:9", mediaInfo{Duration: 10}, true, 136, 1},
+	}
+	for _, tt := range tests {
+		set, ok := newThumbnailSet(tt.media)
+		if ok != tt.ok {
+			t.Errorf("%s: ok = %v, esperado %v", tt.name, ok, tt.ok)
+			continue
+		}
+		if ok && (set.Width != thumbnailWidth || set.Height != tt.height || set.Sheets != tt.sheets) {
+			t.Errorf("%s: %dx%d em %d folhas, esperado %dx%d em %d", tt.name, set.Width, set.Height, set.Sheets, thumbnailWidth, tt.height, tt.sheets)
+		}
+	}
+}
+
+func TestWriteThumbnailTrack(t *testing.T) {
+	dir := t.TempDir()
+	// 255s: 26 miniaturas, a 26ª na segunda folha e mais curta que o intervalo
+	set := thumbnailSet{Width: 240, Height: 136, Sheets: 2, Duration: 255}
+
+	if err := writeThumbnailTrack(dir, set); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "thumbnails.vtt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	track := string(data)
+
+	if n := strings.Count(track, " --> "); n != 26 {
+		t.Errorf("%d cues, esperado 26", n)
+	}
+	for _, cue := range []string{
+		"00:00:00.000 --> 00:00:10.000\nsprite000.jpg#xywh=0,0,240,136\n",
+		"00:01:00.000 --> 00:01:10.000\nsprite000.jpg#xywh=240,136,240,136\n", // 7ª: linha 1, coluna 1
+		"00:04:00.000 --> 00:04:10.000\nsprite000.jpg#xywh=960,544,240,136\n", // 25ª: último canto da folha
+		"00:04:10.000 --> 00:04:15.000\nsprite001.jpg#xywh=0,0,240,136\n",     // Nova folha, cue final curta
+	} {
+		if !strings.Contains(track, cue) {
+			t.Errorf("trilha sem a cue:\n%s", cue)
+		}
+	}
+
+	if err := writeThumbnailPlaylist(dir, set); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(filepath.Join(dir, "playlist.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	playlist := string(data)
+	for _, line := range []string{
+		"#EXT-X-TARGETDURATION:250\n",
+		"#EXTINF:250.000,\n#EXT-X-TILES:RESOLUTION=240x136,LAYOUT=5x5,DURATION=10.000\nsprite000.jpg\n",
+		"#EXTINF:5.000,\n#EXT-X-TILES:RESOLUTION=240x136,LAYOUT=5x5,DURATION=10.000\nsprite001.jpg\n",
+	} {
+		if !strings.Contains(playlist, line) {
+			t.Errorf("playlist de imagens sem:\n%s\n\n%s", line, playlist)
+		}
+	}
+	if !strings.Contains(set.imageStreamInf(), `RESOLUTION=1200x680,CODECS="jpeg",URI="thumbs/playlist.m3u8"`) {
+		t.Errorf("EXT-X-IMAGE-STREAM-INF inesperado: %s", set.imageStreamInf())
+	}
+}
+
+func TestVTTTimestamp(t *testing.T) {
+	for seconds, want := range map[float64]string{
+		0:        "00:00:00.000",
+		9.9996:   "00:00:10.000",
+		61.5:     "00:01:01.500",
+		3725.042: "01:02:05.042",
+	} {
+		if got := vttTimestamp(seconds); got != want {
+			t.Errorf("vttTimestamp(%v) = %q, esperado %q", seconds, got, want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package torrent
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Playlist gravada pelo FFmpeg em cada rendition. O player recebe a playlist.m3u8
+// sintetizada (VOD completa); a do FFmpeg só é servida na variante sem reencode
+// ou quando a duração do vídeo é desconhecida.
+const encoderPlaylistName = "encoder.m3u8"
+
+// vodSegmentCount é o número de segmentos que cobrem a duração do vídeo
+func vodSegmentCount(cfg *EncodingConfig, duration float64) int {
+	return int(math.Ceil(duration/float64(cfg.SegmentDuration) - 1e-6))
+}
+
+// writeVODPlaylist escreve em dir a playlist.m3u8 completa de uma rendition: todos os
+// segmentos até o fim do vídeo e #EXT-X-ENDLIST. Os cortes são previsíveis porque os
+// keyframes são forçados a cada segment_duration (ver videoCodecArgs); segmentos ainda
+// não gerados são produzidos quando pedidos (ver SeekToSegment).
+func writeVODPlaylist(dir string, cfg *EncodingConfig, duration float64, initName string) error {
+	segment := float64(cfg.SegmentDuration)
+
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	if segmentFormat == SegmentFormatFMP4 {
+		b.WriteString("#EXT-X-VERSION:7\n")
+	} else {
+		b.WriteString("#EXT-X-VERSION:3\n")
+	}
+	// Os segmentos reais podem passar da duração nominal por até um quadro
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", cfg.SegmentDuration+1)
+	b.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n")
+	b.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
+	b.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
+	if segmentFormat == SegmentFormatFMP4 {
+		fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"%s\"\n", initName)
+	}
+
+	count := vodSegmentCount(cfg, duration)
+	for n := 0; n < count; n++ {
+		length := math.Min(segment, duration-float64(n)*segment)
+		fmt.Fprintf(&b, "#EXTINF:%.6f,\n", length)
+		fmt.Fprintf(&b, "segment%03d%s\n", n, segmentExt())
+	}
+	b.WriteString("#EXT-X-ENDLIST\n")
+
+	// Escrita atômica: o player pode pedir a playlist a qualquer momento
+	path := filepath.Join(dir, "playlist.m3u8")
+	if err := os.WriteFile(path+".tmp", []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// writeVODPlaylists sintetiza as playlists de todas as qualidades reencodadas e renditions
+// de áudio do arquivo atual, antes de qualquer segmento existir. Sem duração conhecida
+// nada é sintetizado e o player recebe as playlists do FFmpeg (ver PlaylistName).
+func writeVODPlaylists(stream *StreamInfo, qualities []QualityLevel, audio []AudioRendition) error {
+	media := stream.currentMedia()
+	if media.Duration <= 0 {
+		return fmt.Errorf("duração do vídeo desconhecida")
+	}
+	cfg := stream.encodingConfig()
+	hlsDir := stream.hlsDir()
+
+	for _, q := range qualities {
+		// O remux corta nos keyframes da fonte: a playlist é a do FFmpeg
+		if q.Copy {
+			continue
+		}
+		dir := filepath.Join(hlsDir, q.Name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err := writeVODPlaylist(dir, cfg, media.Duration, initSegmentName(q.Name)); err != nil {
+			return err
+		}
+	}
+	for _, r := range audio {
+		dir := filepath.Join(hlsDir, r.Name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err := writeVODPlaylist(dir, cfg, media.Duration, "init.mp4"); err != nil {
+			return err
+		}
+	}
+
+	stream.mu.Lock()
+	stream.vodPlaylists = true
+	stream.mu.Unlock()
+	return nil
+}
+
+// PlaylistName retorna o arquivo servido como <rendition>/playlist.m3u8: a playlist
+// sintetizada, ou a do FFmpeg na variante sem reencode e quando a síntese falhou.
+// Legendas e miniaturas publicam a própria playlist.m3u8 (ver publishSubtitlePlaylist).
+func (s *StreamInfo) PlaylistName(rendition string) string {
+	q, isQuality := s.findQuality(rendition)
+	if isQuality && q.Copy {
+		return encoderPlaylistName
+	}
+	if _, isAudio := s.findAudioRendition(rendition); !isQuality && !isAudio {
+		return "playlist.m3u8"
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.vodPlaylists {
+		return encoderPlaylistName
+	}
+	return "playlist.m3u8"
+}
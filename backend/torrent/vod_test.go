@@ -0,0 +1,94 @@
+package torrent
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestVODStream cria um stream com escada e áudio prontos para sintetizar playlists em dir
+func newTestVODStream(dir string, duration float64) *StreamInfo {
+	stream := newTestStream(StateTranscoding)
+	stream.hlsPath = dir
+	stream.encoding = &EncodingConfig{SegmentDuration: 2}
+	stream.media.Duration = duration
+	stream.ladder = []QualityLevel{{Name: "360p"}, {Name: "original", Copy: true}}
+	stream.audioRenditions = []AudioRendition{{Name: "audio0"}}
+	stream.media.SubtitleTracks = []SubtitleTrackInfo{{Rendition: "sub0"}}
+	return stream
+}
+
+func TestWriteVODPlaylists(t *testing.T) {
+	dir := t.TempDir()
+	stream := newTestVODStream(dir, 5)
+
+	if err := writeVODPlaylists(stream, stream.ladder, stream.audioRenditions); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "360p", "playlist.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	playlist := string(data)
+	if n := strings.Count(playlist, "#EXTINF:"); n != 3 {
+		t.Errorf("%d segmentos, esperado 3", n)
+	}
+	if !strings.Contains(playlist, "#EXTINF:1.000000,\nsegment002") || !strings.HasSuffix(playlist, "#EXT-X-ENDLIST\n") {
+		t.Errorf("playlist VOD inesperada:\n%s", playlist)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "audio0", "playlist.m3u8")); err != nil {
+		t.Errorf("playlist do áudio não sintetizada: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "original", "playlist.m3u8")); err == nil {
+		t.Error("variante sem reencode recebeu playlist sintetizada")
+	}
+
+	for rendition, want := range map[string]string{
+		"360p":     "playlist.m3u8",
+		"audio0":   "playlist.m3u8",
+		"original": encoderPlaylistName,
+		"sub0":     "playlist.m3u8",
+	} {
+		if got := stream.PlaylistName(rendition); got != want {
+			t.Errorf("PlaylistName(%q) = %q, esperado %q", rendition, got, want)
+		}
+	}
+}
+
+func TestWriteVODPlaylistsUnknownDuration(t *testing.T) {
+	dir := t.TempDir()
+	stream := newTestVODStream(dir, 0)
+
+	if err := writeVODPlaylists(stream, stream.ladder, stream.audioRenditions); err == nil {
+		t.Fatal("duração desconhecida não retornou erro")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "360p", "playlist.m3u8")); err == nil {
+		t.Error("playlist sintetizada sem duração conhecida")
+	}
+
+	// Sem playlist sintetizada o player recebe a do FFmpeg no vídeo e no áudio.
+	// A legenda continua com a playlist EVENT publicada pela extração.
+	for rendition, want := range map[string]string{
+		"360p":     encoderPlaylistName,
+		"audio0":   encoderPlaylistName,
+		"original": encoderPlaylistName,
+		"sub0":     "playlist.m3u8",
+	} {
+		if got := stream.PlaylistName(rendition); got != want {
+			t.Errorf("PlaylistName(%q) = %q, esperado %q", rendition, got, want)
+		}
+	}
+
+	// A troca de arquivo volta a exigir a síntese
+	stream.media.Duration = 5
+	if err := writeVODPlaylists(stream, stream.ladder, stream.audioRenditions); err != nil {
+		t.Fatal(err)
+	}
+	stream.resetForFile()
+	stream.ladder = []QualityLevel{{Name: "360p"}} // Escada do novo arquivo, antes da síntese
+	if got := stream.PlaylistName("360p"); got != encoderPlaylistName {
+		t.Errorf("após resetForFile, PlaylistName = %q, esperado %q", got, encoderPlaylistName)
+	}
+}